@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+// runExport implements `telecollector export [flags]`,
+// entries are written to stdout unless an output file is given
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", telecollector.ExportJSONLines, "output format: jsonl, csv or md")
+	out := fs.String("o", "", "output file, stdout by default")
+	tags := fs.String("tag", "", "comma separated tags every entry must have")
+	chats := fs.String("chat", "", "comma separated chat ids")
+	author := fs.String("author", "", "author id")
+	since := fs.String("since", "", "first day, YYYY-MM-DD")
+	until := fs.String("until", "", "last day, YYYY-MM-DD")
+	text := fs.String("q", "", "full-text query")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Filters share syntax with the bot commands
+	filters := make([]string, 0)
+	for _, t := range splitList(*tags) {
+		filters = append(filters, "#"+strings.TrimPrefix(t, "#"))
+	}
+	for _, c := range splitList(*chats) {
+		filters = append(filters, "chat:"+c)
+	}
+	if len(*author) != 0 {
+		filters = append(filters, "author:"+*author)
+	}
+	if len(*since) != 0 {
+		filters = append(filters, "since:"+*since)
+	}
+	if len(*until) != 0 {
+		filters = append(filters, "until:"+*until)
+	}
+
+	q, err := telecollector.ParseSearchQuery(filters)
+	if err != nil {
+		return err
+	}
+	q.Text = *text
+	q.Chronological = true
+
+	var w io.Writer = os.Stdout
+	if len(*out) != 0 {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := telecollector.Export(svc.Messages, q, *format, w)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("export: %d entries exported", count)
+	return nil
+}
+
+func splitList(s string) []string {
+	res := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) != 0 {
+			res = append(res, v)
+		}
+	}
+	return res
+}
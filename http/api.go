@@ -0,0 +1,388 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	ContextKeyAPIKey ContextKey = "api_key_context"
+
+	apiPrefix       = "/api/v1/"
+	apiDefaultLimit = 50
+	apiMaxLimit     = 200
+	apiDateLayout   = "2006-01-02"
+)
+
+type apiEntry struct {
+	MessageID  int64                     `json:"message_id"`
+	ChatID     int64                     `json:"chat_id"`
+	ChatName   string                    `json:"chat_name"`
+	AuthorID   int64                     `json:"author_id"`
+	AuthorName string                    `json:"author_name"`
+	Date       time.Time                 `json:"date"`
+	Updated    time.Time                 `json:"updated"`
+	Text       string                    `json:"text"`
+	Entities   []*telegram.MessageEntity `json:"entities"`
+	Tags       []string                  `json:"tags"`
+	Note       string                    `json:"note,omitempty"`
+	Highlight  string                    `json:"highlight,omitempty"`
+	Link       string                    `json:"link"`
+	Parts      []string                  `json:"parts,omitempty"`
+	Broadcasts []*apiBroadcast           `json:"broadcasts,omitempty"`
+}
+
+type apiBroadcast struct {
+	ChannelID  int64   `json:"channel_id"`
+	MessageIDs []int64 `json:"message_ids"`
+	Link       string  `json:"link,omitempty"`
+}
+
+type apiEntries struct {
+	Entries    []*apiEntry `json:"entries"`
+	NextOffset *int        `json:"next_offset,omitempty"`
+}
+
+type apiTag struct {
+	Tag     string `json:"tag"`
+	Entries int64  `json:"entries"`
+}
+
+type apiChat struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Entries int64  `json:"entries"`
+}
+
+type apiAuthor struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	UserName string `json:"username,omitempty"`
+	Entries  int64  `json:"entries"`
+}
+
+// routeAPI dispatches read-only REST API:
+//
+//	GET /api/v1/entries?q=&tag=&chat=&author=&since=&until=&offset=&limit=
+//	GET /api/v1/entries/<chat_id>/<message_id>
+//	GET /api/v1/tags
+//	GET /api/v1/chats
+//	GET /api/v1/authors
+func (s *server) routeAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+		switch {
+		case path[0] == "entries" && len(path) == 1:
+			s.handleAPIEntries()(w, r)
+		case path[0] == "entries" && len(path) == 3:
+			s.handleAPIEntry(path[1], path[2])(w, r)
+		case path[0] == "tags" && len(path) == 1:
+			s.handleAPITags()(w, r)
+		case path[0] == "chats" && len(path) == 1:
+			s.handleAPIChats()(w, r)
+		case path[0] == "authors" && len(path) == 1:
+			s.handleAPIAuthors()(w, r)
+		default:
+			s.respondAPIError(w, http.StatusNotFound, "Not found")
+		}
+	}
+}
+
+// onlyAPIKey lets through GET requests with a valid key in `Authorization: Bearer <key>`
+// or `X-API-Key` header, `key` URL parameter is for clients like feed readers which can't set headers
+func (s *server) onlyAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.respondAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		token := r.URL.Query().Get("key")
+		if key := r.Header.Get("X-API-Key"); len(key) != 0 {
+			token = key
+		}
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if len(token) == 0 {
+			s.respondAPIError(w, http.StatusUnauthorized, "API key is missing")
+			return
+		}
+
+		key, err := s.keyService.CheckKey(token)
+		if err != nil {
+			log.Printf("server: error checking api key: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error checking API key")
+			return
+		}
+		if key == nil {
+			s.respondAPIError(w, http.StatusUnauthorized, "API key is invalid")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ContextKeyAPIKey, key)
+		if next != nil {
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
+
+func (s *server) handleAPIEntries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAPISearch(r)
+		if err != nil {
+			s.respondAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// One more entry tells whether there is the next page
+		limit := q.Limit
+		q.Limit++
+		entries, err := s.msgService.Search(q)
+		if err != nil {
+			log.Printf("server: api error searching entries: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error searching entries")
+			return
+		}
+
+		res := apiEntries{Entries: make([]*apiEntry, 0, len(entries))}
+		if len(entries) > limit {
+			entries = entries[:limit]
+			next := q.Offset + limit
+			res.NextOffset = &next
+		}
+		for _, e := range entries {
+			res.Entries = append(res.Entries, s.newAPIEntry(e))
+		}
+
+		s.respondJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *server) handleAPIEntry(chatStr string, msgStr string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chatID, errChat := strconv.ParseInt(chatStr, 10, 64)
+		msgID, errMsg := strconv.ParseInt(msgStr, 10, 64)
+		if errChat != nil || errMsg != nil {
+			s.respondAPIError(w, http.StatusBadRequest, "Chat and message ids should be numbers")
+			return
+		}
+
+		e, err := s.msgService.FindEntry(msgID, chatID)
+		if err != nil {
+			log.Printf("server: api error looking for entry: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error looking for entry")
+			return
+		}
+		if e == nil {
+			s.respondAPIError(w, http.StatusNotFound, "Entry not found")
+			return
+		}
+
+		rv, err := s.modService.FindReview(msgID, chatID)
+		if err != nil {
+			log.Printf("server: api error looking for review: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error looking for entry")
+			return
+		}
+		if rv != nil && rv.Status == telecollector.ReviewPending {
+			s.respondAPIError(w, http.StatusNotFound, "Entry not found")
+			return
+		}
+
+		broadcasts, err := s.msgService.FindBroadcasts(msgID, chatID)
+		if err != nil {
+			log.Printf("server: api error looking for broadcasts: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error looking for broadcasts")
+			return
+		}
+
+		res := s.newAPIEntry(e)
+		res.Parts = e.Parts
+		res.Broadcasts = make([]*apiBroadcast, 0, len(broadcasts))
+		for _, bc := range broadcasts {
+			ab := &apiBroadcast{ChannelID: bc.ChannelID, MessageIDs: bc.MessageIDs}
+			if len(bc.MessageIDs) != 0 && bc.MessageIDs[0] != 0 {
+				ab.Link = telegram.MessageLink(bc.ChannelID, "", bc.MessageIDs[0])
+			}
+			res.Broadcasts = append(res.Broadcasts, ab)
+		}
+
+		s.respondJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *server) handleAPITags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tags, err := s.msgService.Tags()
+		if err != nil {
+			log.Printf("server: api error listing tags: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error listing tags")
+			return
+		}
+
+		res := make([]*apiTag, 0, len(tags))
+		for _, t := range tags {
+			res = append(res, &apiTag{Tag: t.Tag, Entries: t.Entries})
+		}
+		s.respondJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *server) handleAPIChats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chats, err := s.msgService.Chats()
+		if err != nil {
+			log.Printf("server: api error listing chats: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error listing chats")
+			return
+		}
+
+		res := make([]*apiChat, 0, len(chats))
+		for _, c := range chats {
+			res = append(res, &apiChat{ID: c.ID, Name: c.Name, Entries: c.Entries})
+		}
+		s.respondJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *server) handleAPIAuthors() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authors, err := s.msgService.Authors()
+		if err != nil {
+			log.Printf("server: api error listing authors: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error listing authors")
+			return
+		}
+
+		res := make([]*apiAuthor, 0, len(authors))
+		for _, a := range authors {
+			res = append(res, &apiAuthor{ID: a.ID, Name: a.Name, UserName: a.UserName, Entries: a.Entries})
+		}
+		s.respondJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *server) newAPIEntry(e *telecollector.Entry) *apiEntry {
+	res := &apiEntry{
+		MessageID:  e.MessageID,
+		ChatID:     e.ChatID,
+		ChatName:   e.ChatName,
+		AuthorID:   e.AuthorID,
+		AuthorName: e.AuthorName,
+		Date:       time.Unix(e.Date, 0).UTC(),
+		Updated:    time.Unix(e.Updated, 0).UTC(),
+		Text:       e.Text,
+		Entities:   e.Entities,
+		Tags:       e.Tags,
+		Note:       e.Note,
+		Link:       s.entryLink(e),
+	}
+
+	if len(e.Highlight) != 0 {
+		res.Highlight = strings.NewReplacer(telecollector.HighlightStart, "**", telecollector.HighlightStop, "**").
+			Replace(e.Highlight)
+	}
+
+	if res.Entities == nil {
+		res.Entities = make([]*telegram.MessageEntity, 0)
+	}
+	if res.Tags == nil {
+		res.Tags = make([]string, 0)
+	}
+
+	return res
+}
+
+// parseAPISearch reads search query and filters from URL parameters,
+// `tag` and `chat` may be repeated, dates are inclusive `YYYY-MM-DD`
+func parseAPISearch(r *http.Request) (*telecollector.SearchQuery, error) {
+	params := r.URL.Query()
+	q := &telecollector.SearchQuery{
+		Text:  params.Get("q"),
+		Limit: apiDefaultLimit,
+	}
+
+	for _, t := range params["tag"] {
+		q.Tags = append(q.Tags, telecollector.NormalizeTag(t, false))
+	}
+
+	for _, c := range params["chat"] {
+		id, err := strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			return nil, apiParamError("chat")
+		}
+		q.ChatIDs = append(q.ChatIDs, id)
+	}
+
+	var err error
+	if v := params.Get("author"); len(v) != 0 {
+		q.AuthorID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, apiParamError("author")
+		}
+	}
+
+	if v := params.Get("since"); len(v) != 0 {
+		t, err := time.Parse(apiDateLayout, v)
+		if err != nil {
+			return nil, apiParamError("since")
+		}
+		q.Since = t.Unix()
+	}
+
+	if v := params.Get("until"); len(v) != 0 {
+		t, err := time.Parse(apiDateLayout, v)
+		if err != nil {
+			return nil, apiParamError("until")
+		}
+		q.Until = t.Add(24*time.Hour).Unix() - 1
+	}
+
+	if v := params.Get("offset"); len(v) != 0 {
+		q.Offset, err = strconv.Atoi(v)
+		if err != nil || q.Offset < 0 {
+			return nil, apiParamError("offset")
+		}
+	}
+
+	if v := params.Get("limit"); len(v) != 0 {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil || q.Limit <= 0 || q.Limit > apiMaxLimit {
+			return nil, apiParamError("limit")
+		}
+	}
+
+	return q, nil
+}
+
+type apiParamError string
+
+func (e apiParamError) Error() string {
+	return "Parameter `" + string(e) + "` is invalid"
+}
+
+// respondJSON writes the value with the actual status code, unlike respond
+// which always answers 200 to keep Telegram from redelivering updates
+func (s *server) respondJSON(w http.ResponseWriter, st int, v interface{}) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(st)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("server: error creating response: %s", err.Error())
+	}
+}
+
+func (s *server) respondAPIError(w http.ResponseWriter, st int, m string) {
+	s.respondJSON(w, st, response{Status: st, Message: m})
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+// handleAPIKey manages REST API keys in a private chat with the bot:
+// `/apikey list`, `/apikey add <name>`, `/apikey del <key_id>`
+func (s *server) handleAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		// Tokens must not leak into group history
+		if ctxVal.Message.Chat.Type != telegram.ChatTypePrivate {
+			s.replyCommand(w, ctxVal, telegram.PlainText("API keys are managed in a private chat with the bot"))
+			return
+		}
+
+		args := ctxVal.Args()
+		var reply string
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			keys, err := s.keyService.Keys()
+			if err != nil {
+				log.Printf("server: list api keys command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not list API keys")
+				return
+			}
+
+			lines := make([]string, 0, len(keys))
+			for _, k := range keys {
+				used := "never used"
+				if k.LastUsed != nil {
+					used = "used " + k.LastUsed.UTC().Format("2006-01-02 15:04")
+				}
+				lines = append(lines, fmt.Sprintf("%d: %s, created %s, %s",
+					k.ID, k.Name, k.Created.UTC().Format("2006-01-02"), used))
+			}
+			reply = "No API keys"
+			if len(lines) != 0 {
+				reply = strings.Join(lines, "\n")
+			}
+		case args[0] == "add" && len(args) > 1:
+			token, k, err := s.keyService.CreateKey(strings.Join(args[1:], " "), ctxVal.Message.Author().ID)
+			if err != nil {
+				log.Printf("server: add api key command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not add API key")
+				return
+			}
+			reply = fmt.Sprintf("Key %d: %s\n%s\nIt is shown only once", k.ID, k.Name, token)
+		case args[0] == "del" && len(args) == 2:
+			id, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				reply = "Key id should be a number"
+				break
+			}
+
+			err = s.keyService.RevokeKey(id)
+			if err != nil {
+				log.Printf("server: delete api key command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not delete API key")
+				return
+			}
+			reply = "Revoked"
+		default:
+			reply = "Usage: /apikey list | add <name> | del <key_id>"
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
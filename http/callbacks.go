@@ -0,0 +1,146 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+// Telegram limits callback data to 64 bytes
+const (
+	callbackDataLimit = 64
+	callbackSeparator = ":"
+	callbackSigLength = 6
+)
+
+var (
+	ErrCallbackTooLong   = errors.New("server: callback payload exceeds 64 bytes")
+	ErrCallbackSeparator = errors.New("server: callback argument contains separator")
+	ErrCallbackSignature = errors.New("server: callback payload signature mismatch")
+)
+
+// callbackHandler handles pressed button with its decoded arguments,
+// returned text is shown to the user as callback answer
+type callbackHandler func(cq *telegram.CallbackQuery, args []string) (string, error)
+
+// callbackRouter dispatches callback queries to handlers registered by action.
+// Payload is `action:arg...:signature` where signature is truncated HMAC of the
+// rest, so buttons can't be forged by clients sending arbitrary callback data.
+type callbackRouter struct {
+	secret   []byte
+	handlers map[string]callbackHandler
+}
+
+func newCallbackRouter(secret string) *callbackRouter {
+	return &callbackRouter{
+		secret:   []byte(secret),
+		handlers: make(map[string]callbackHandler),
+	}
+}
+
+func (cr *callbackRouter) register(action string, h callbackHandler) {
+	cr.handlers[action] = h
+}
+
+func (cr *callbackRouter) sign(payload string) string {
+	mac := hmac.New(sha256.New, cr.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSigLength])
+}
+
+func (cr *callbackRouter) encode(action string, args ...string) (string, error) {
+	for _, a := range append([]string{action}, args...) {
+		if strings.Contains(a, callbackSeparator) {
+			return "", ErrCallbackSeparator
+		}
+	}
+
+	payload := strings.Join(append([]string{action}, args...), callbackSeparator)
+	data := payload + callbackSeparator + cr.sign(payload)
+	if len(data) > callbackDataLimit {
+		return "", ErrCallbackTooLong
+	}
+
+	return data, nil
+}
+
+func (cr *callbackRouter) decode(data string) (string, []string, error) {
+	i := strings.LastIndex(data, callbackSeparator)
+	if i < 0 {
+		return "", nil, ErrCallbackSignature
+	}
+
+	payload, sig := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(cr.sign(payload))) {
+		return "", nil, ErrCallbackSignature
+	}
+
+	parts := strings.Split(payload, callbackSeparator)
+	return parts[0], parts[1:], nil
+}
+
+// button builds inline keyboard button with signed payload
+func (cr *callbackRouter) button(text string, action string, args ...string) (*telegram.InlineKeyboardButton, error) {
+	data, err := cr.encode(action, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &telegram.InlineKeyboardButton{Text: text, CallbackData: data}, nil
+}
+
+// packInt and unpackInt keep numeric arguments compact
+func packInt(n int64) string {
+	return strconv.FormatInt(n, 36)
+}
+
+func unpackInt(s string) (int64, error) {
+	return strconv.ParseInt(s, 36, 64)
+}
+
+func (s *server) routeCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upd, ok := r.Context().Value(ContextKeyUpdate).(*telegram.Update)
+		if !ok {
+			s.respond(w, http.StatusNotAcceptable, "Unable to route update")
+			return
+		}
+
+		cq := upd.CallbackQuery
+		action, args, err := s.callbacks.decode(cq.Data)
+		if err != nil {
+			s.answerCallback(w, cq, "This button is not valid anymore")
+			return
+		}
+
+		h, ok := s.callbacks.handlers[action]
+		if !ok {
+			s.answerCallback(w, cq, "This button is not supported anymore")
+			return
+		}
+
+		text, err := h(cq, args)
+		if err != nil {
+			log.Printf("server: error handling `%s` callback: %s", action, err.Error())
+			s.answerCallback(w, cq, "Something went wrong")
+			return
+		}
+
+		s.answerCallback(w, cq, text)
+	}
+}
+
+func (s *server) answerCallback(w http.ResponseWriter, cq *telegram.CallbackQuery, text string) {
+	err := s.bot.AnswerCallbackQuery(cq.ID, text)
+	if err != nil {
+		log.Printf("server: error answering callback query: %s", err.Error())
+	}
+	s.respond(w, http.StatusOK, "OK")
+}
@@ -1,8 +1,14 @@
 package http
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kalambet/telecollector/telegram"
 
 	"github.com/kalambet/telecollector/telecollector"
 )
@@ -27,6 +33,51 @@ func (s *server) routeCommand() http.HandlerFunc {
 		case telecollector.CommandUnfollow:
 			s.onlyAdminCommand(s.handleUnfollow())(w, r)
 			return
+		case telecollector.CommandRoute:
+			s.onlyAdminCommand(s.handleRoute())(w, r)
+			return
+		case telecollector.CommandTrigger:
+			s.onlyAdminCommand(s.handleTrigger())(w, r)
+			return
+		case telecollector.CommandRule:
+			s.onlyAdminCommand(s.handleRule())(w, r)
+			return
+		case telecollector.CommandReaction:
+			s.onlyAdminCommand(s.handleReaction())(w, r)
+			return
+		case telecollector.CommandCollect, telecollector.CommandSave:
+			s.handleCollect()(w, r)
+			return
+		case telecollector.CommandForget:
+			s.handleForget()(w, r)
+			return
+		case telecollector.CommandModerate:
+			s.onlyAdminCommand(s.handleModerate())(w, r)
+			return
+		case telecollector.CommandAPIKey:
+			s.onlyAdminCommand(s.handleAPIKey())(w, r)
+			return
+		case telecollector.CommandRetention:
+			s.onlyAdminCommand(s.handleRetention())(w, r)
+			return
+		case telecollector.CommandUserData:
+			s.onlyAdminCommand(s.handleUserData())(w, r)
+			return
+		case telecollector.CommandExport:
+			s.onlyAdminCommand(s.handleExport())(w, r)
+			return
+		case telecollector.CommandSearch:
+			s.handleSearch()(w, r)
+			return
+		case telecollector.CommandDigest:
+			s.handleDigest()(w, r)
+			return
+		case telecollector.CommandOptOut:
+			s.handleOptOut(true)(w, r)
+			return
+		case telecollector.CommandOptIn:
+			s.handleOptOut(false)(w, r)
+			return
 		case telecollector.CommandWhoami:
 			s.handleWhoami()(w, r)
 			return
@@ -73,6 +124,48 @@ func (s *server) handleUnfollow() http.HandlerFunc {
 	}
 }
 
+// handleCollect saves and broadcasts the message the command replies to,
+// text after the command is attached as the collector's note
+func (s *server) handleCollect() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		if ctxVal.Message.ReplyToMessage == nil {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Reply to the message you want to collect"))
+			return
+		}
+
+		// Original message is collected as is: with its own author, date and entities
+		orig := *ctxVal.Message.ReplyToMessage
+		orig.ReplyToMessage = nil
+
+		collected, err := s.msgService.IsCollected(orig.ID, orig.Chat.ID)
+		if err != nil {
+			log.Printf("server: error checking collected message: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error checking collected message")
+			return
+		}
+		if collected {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Already collected"))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ContextKeyMessage, &telecollector.MessageContext{
+			Message:            &orig,
+			ConnectedMessageID: orig.ID - 1,
+			UpdateID:           ctxVal.UpdateID,
+			Action:             telecollector.ActionSave,
+			Note:               ctxVal.Message.CommandText(),
+			NoteAuthorID:       ctxVal.Message.Author().ID,
+		})
+		s.onlyWhitelistedChats(s.onlyOptedInAuthors(s.handleMessage()))(w, r.WithContext(ctx))
+	}
+}
+
 func (s *server) handleWhoami() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
@@ -91,3 +184,239 @@ func (s *server) handleWhoami() http.HandlerFunc {
 		s.respond(w, http.StatusOK, "OK")
 	}
 }
+
+// handleRoute manages broadcast routing table:
+// `/route list`, `/route add <channel_id> [chat=..] [tag=..] [author=..]`, `/route del <route_id>`
+func (s *server) handleRoute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		var reply string
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			lines := make([]string, 0)
+			for _, rt := range s.routeService.Routes() {
+				lines = append(lines, rt.String())
+			}
+			reply = "No routes, everything goes to the default channel"
+			if len(lines) != 0 {
+				reply = strings.Join(lines, "\n")
+			}
+		case args[0] == "add":
+			rt, err := telecollector.ParseRoute(args[1:])
+			if err != nil {
+				reply = err.Error()
+				break
+			}
+
+			err = s.routeService.AddRoute(rt)
+			if err != nil {
+				log.Printf("server: add route command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not add route")
+				return
+			}
+			reply = "Added " + rt.String()
+		case args[0] == "del" && len(args) == 2:
+			id, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				reply = "Route id should be a number"
+				break
+			}
+
+			err = s.routeService.RemoveRoute(id)
+			if err != nil {
+				log.Printf("server: delete route command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not delete route")
+				return
+			}
+			reply = "Deleted"
+		default:
+			reply = "Usage: /route list | add <channel_id> [chat=<id>] [tag=<#tag>] [author=<id>] | del <route_id>"
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
+
+// handleTrigger manages tags which trigger collection in the current chat
+// or globally: `/trigger list`, `/trigger add <#tag> [global]`, `/trigger del <#tag> [global]`
+func (s *server) handleTrigger() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		chatID := ctxVal.Message.Chat.ID
+		if len(args) != 0 && args[len(args)-1] == "global" {
+			chatID = telecollector.TriggerScopeGlobal
+			args = args[:len(args)-1]
+		}
+
+		var reply string
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			reply = "Trigger tags: " + strings.Join(s.trigService.Triggers(chatID), " ")
+		case args[0] == "add" && len(args) > 1:
+			for _, tag := range args[1:] {
+				err := s.trigService.AddTrigger(chatID, tag)
+				if err != nil {
+					log.Printf("server: add trigger command error: %s", err.Error())
+					s.respond(w, http.StatusInternalServerError, "Can not add trigger")
+					return
+				}
+			}
+			reply = "Trigger tags: " + strings.Join(s.trigService.Triggers(chatID), " ")
+		case args[0] == "del" && len(args) > 1:
+			for _, tag := range args[1:] {
+				err := s.trigService.RemoveTrigger(chatID, tag)
+				if err != nil {
+					log.Printf("server: delete trigger command error: %s", err.Error())
+					s.respond(w, http.StatusInternalServerError, "Can not delete trigger")
+					return
+				}
+			}
+			reply = "Trigger tags: " + strings.Join(s.trigService.Triggers(chatID), " ")
+		default:
+			reply = "Usage: /trigger list | add <#tag>... | del <#tag>... [global]"
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
+
+// handleRule manages collection rules of the current chat:
+// `/rule list`, `/rule add <expression>`, `/rule del <rule_id>`
+func (s *server) handleRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		chatID := ctxVal.Message.Chat.ID
+		var reply string
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			lines := make([]string, 0)
+			for _, rl := range s.trigService.Rules(chatID) {
+				lines = append(lines, fmt.Sprintf("%d: %s", rl.ID, rl.Expression))
+			}
+			reply = "No rules, only trigger tags are collected"
+			if len(lines) != 0 {
+				reply = strings.Join(lines, "\n")
+			}
+		case args[0] == "add" && len(args) > 1:
+			// Expression is taken as typed, so regexes and phrases keep their whitespace
+			expr := strings.TrimSpace(strings.TrimPrefix(ctxVal.Message.CommandText().Text, args[0]))
+			rl, err := s.trigService.AddRule(chatID, expr)
+			if err != nil {
+				log.Printf("server: add rule command error: %s", err.Error())
+				reply = "Can not add rule: " + err.Error()
+				break
+			}
+			reply = fmt.Sprintf("Added %d: %s", rl.ID, rl.Matcher.String())
+		case args[0] == "del" && len(args) == 2:
+			id, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				reply = "Rule id should be a number"
+				break
+			}
+
+			err = s.trigService.RemoveRule(chatID, id)
+			if err != nil {
+				log.Printf("server: delete rule command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not delete rule")
+				return
+			}
+			reply = "Deleted"
+		default:
+			reply = "Usage: /rule list | add <expression> | del <rule_id>\n" +
+				"Expression terms: #tag, #prefix*, word, \"some phrase\", /regex/, domain:example.com, author:<id>; " +
+				"operators: and, or, not, ( )"
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
+
+// handleReaction manages reactions which collect messages in the current chat
+// or globally: `/reaction list`, `/reaction add <emoji> [threshold]`, `/reaction del <emoji>`
+func (s *server) handleReaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		chatID := ctxVal.Message.Chat.ID
+		if len(args) != 0 && args[len(args)-1] == "global" {
+			chatID = telecollector.TriggerScopeGlobal
+			args = args[:len(args)-1]
+		}
+
+		var reply string
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			lines := make([]string, 0)
+			for _, t := range s.reactService.ReactionTriggers(chatID) {
+				lines = append(lines, fmt.Sprintf("%s × %d", t.Emoji, t.Threshold))
+			}
+			reply = "No reactions collect messages here"
+			if len(lines) != 0 {
+				reply = strings.Join(lines, "\n")
+			}
+		case args[0] == "add" && (len(args) == 2 || len(args) == 3):
+			t := &telecollector.ReactionTrigger{ChatID: chatID, Emoji: args[1], Threshold: 1}
+			if len(args) == 3 {
+				threshold, err := strconv.Atoi(args[2])
+				if err != nil {
+					reply = "Threshold should be a number"
+					break
+				}
+				t.Threshold = threshold
+			}
+
+			err := s.reactService.AddReactionTrigger(t)
+			if err != nil {
+				log.Printf("server: add reaction command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not add reaction")
+				return
+			}
+			reply = fmt.Sprintf("Messages with %s × %d are collected", t.Emoji, t.Threshold)
+		case args[0] == "del" && len(args) == 2:
+			err := s.reactService.RemoveReactionTrigger(chatID, args[1])
+			if err != nil {
+				log.Printf("server: delete reaction command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not delete reaction")
+				return
+			}
+			reply = "Deleted"
+		default:
+			reply = "Usage: /reaction list | add <emoji> [threshold] | del <emoji> [global]"
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
+
+func (s *server) replyCommand(w http.ResponseWriter, ctxVal *telecollector.CommandContext, text *telegram.Text) {
+	_, err := s.bot.ReplyMessage(text, ctxVal.Message.Chat.ID, ctxVal.Message.ID)
+	if err != nil {
+		log.Printf("server: error sending `%s` response: %s", ctxVal.CommandName, err.Error())
+		s.respond(w, http.StatusInternalServerError, "Error sending command response")
+		return
+	}
+	s.respond(w, http.StatusOK, "OK")
+}
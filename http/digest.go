@@ -0,0 +1,240 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	digestTitleLimit = 80
+	digestUsage      = "Usage: /digest [daily | weekly | <days>]"
+	digestMaxDays    = 31
+)
+
+// digestConfig reads DIGEST_SCHEDULE and DIGEST_CHAT, digests go to
+// the broadcast channel unless the chat is set
+func digestConfig() ([]*telecollector.DigestSchedule, int64) {
+	schedules, err := telecollector.ParseDigestSchedules(os.Getenv("DIGEST_SCHEDULE"))
+	if err != nil {
+		log.Printf("server: digests are not scheduled: %s", err.Error())
+		schedules = nil
+	}
+
+	chatID, err := strconv.ParseInt(os.Getenv("DIGEST_CHAT"), 10, 64)
+	if err != nil {
+		chatID = 0
+	}
+
+	return schedules, chatID
+}
+
+// scheduleDigests adds a job per digest schedule, the job posts the period
+// which ends at the scheduled time even when the run is late
+func (s *server) scheduleDigests() {
+	for _, ds := range s.digests {
+		ds := ds
+		err := s.scheduler.Add("digest "+ds.String(), ds.Cron(), func(at time.Time) error {
+			chatID := ds.ChatID
+			if chatID == 0 {
+				chatID = s.digestChat
+			}
+			return s.postDigest(chatID, at.AddDate(0, 0, -ds.Days()), at)
+		})
+		if err != nil {
+			log.Printf("server: error scheduling %s digest: %s", ds.Period, err.Error())
+		}
+	}
+}
+
+// postDigest posts entries dated within the period which were broadcasted to the chat,
+// so the digest never shows more than its readers could see in the chat
+func (s *server) postDigest(chatID int64, since time.Time, until time.Time) error {
+	bot := s.bot
+	if chatID != 0 {
+		bot = s.bot.ToChannel(chatID)
+	}
+	if bot.Channel() == 0 {
+		return fmt.Errorf("digest chat is not configured")
+	}
+
+	// Dedicated digest chat gets no broadcasts, so it gets the digest of the default channel
+	source := bot.Channel()
+	if !s.isDestination(source) {
+		source = s.bot.Channel()
+	}
+
+	// Entries link to their broadcasts in the source, readers may not open the rest
+	links := make(map[*telecollector.Entry]string)
+	d, err := telecollector.BuildDigest(s.msgService, s.digestChats(), since, until, func(e *telecollector.Entry) bool {
+		bc := s.broadcastIn(e, source)
+		if bc == nil {
+			return false
+		}
+		links[e] = telegram.MessageLink(source, "", bc.MessageIDs[0])
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if d.Entries == 0 {
+		log.Printf("server: digest of %s is empty, nothing is posted", digestPeriod(d))
+		return nil
+	}
+
+	parts := s.digestText(d, func(e *telecollector.Entry) string {
+		return links[e]
+	})
+	for _, part := range parts {
+		_, err = bot.SendMessage(part)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// digestChats lists followed group chats, private chats are never digested
+// into channels, their ids are positive as they are ids of users
+func (s *server) digestChats() []int64 {
+	res := make([]int64, 0)
+	for _, id := range s.credService.FollowedChats() {
+		if id < 0 {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// isDestination reports whether entries are broadcasted to the channel
+func (s *server) isDestination(channelID int64) bool {
+	if channelID == s.bot.Channel() {
+		return true
+	}
+	for _, r := range s.routeService.Routes() {
+		if r.ChannelID == channelID {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcastIn returns the broadcast of the entry made to the channel,
+// nil when the entry was not broadcasted there
+func (s *server) broadcastIn(e *telecollector.Entry, channelID int64) *telecollector.Broadcast {
+	broadcasts, err := s.msgService.FindBroadcasts(e.MessageID, e.ChatID)
+	if err != nil {
+		log.Printf("server: error looking for broadcast message: %s", err.Error())
+		return nil
+	}
+
+	for _, bc := range broadcasts {
+		if bc.ChannelID == channelID && len(bc.MessageIDs) != 0 && bc.MessageIDs[0] != 0 {
+			return bc
+		}
+	}
+	return nil
+}
+
+// handleDigest replies with the digest of chats the user can read,
+// the day before is taken unless other period is asked
+func (s *server) handleDigest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		days := 1
+		args := ctxVal.Args()
+		switch {
+		case len(args) == 0 || args[0] == telecollector.DigestDaily:
+		case args[0] == telecollector.DigestWeekly:
+			days = 7
+		default:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 || n > digestMaxDays {
+				s.replyCommand(w, ctxVal, telegram.PlainText(digestUsage))
+				return
+			}
+			days = n
+		}
+
+		chatIDs := s.searchableChats(ctxVal.Message.Chat, ctxVal.Message.Author().ID, nil)
+		if len(chatIDs) == 0 {
+			s.replyCommand(w, ctxVal, telegram.PlainText("There are no chats you can read"))
+			return
+		}
+
+		until := time.Now()
+		d, err := telecollector.BuildDigest(s.msgService, chatIDs, until.AddDate(0, 0, -days), until, nil)
+		if err != nil {
+			log.Printf("server: digest command error: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error building digest")
+			return
+		}
+		if d.Entries == 0 {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Nothing was collected "+digestPeriod(d)))
+			return
+		}
+
+		for _, part := range s.digestText(d, s.entryLink) {
+			_, err = s.bot.ReplyMessage(part, ctxVal.Message.Chat.ID, ctxVal.Message.ID)
+			if err != nil {
+				log.Printf("server: error sending `%s` response: %s", ctxVal.CommandName, err.Error())
+				s.respond(w, http.StatusInternalServerError, "Error sending command response")
+				return
+			}
+		}
+		s.respond(w, http.StatusOK, "OK")
+	}
+}
+
+// digestText renders the digest as HTML messages with entries pointing to their links,
+// lines are never split between messages, so every message stays valid markup
+func (s *server) digestText(d *telecollector.Digest, link func(e *telecollector.Entry) string) []*telegram.Text {
+	lines := []string{fmt.Sprintf("<b>Digest %s</b>: %d entries", telegram.EscapeHTML(digestPeriod(d)), d.Entries)}
+	for _, g := range d.Groups {
+		lines = append(lines, "", "<b>"+telegram.EscapeHTML(g.Tag)+"</b>")
+		for _, c := range g.Chats {
+			lines = append(lines, "<i>"+telegram.EscapeHTML(c.ChatName)+"</i>")
+			for _, e := range c.Entries {
+				lines = append(lines, fmt.Sprintf("• <a href=\"%s\">%s</a> — %s",
+					telegram.EscapeHTML(link(e)), telegram.EscapeHTML(entryTitle(e, digestTitleLimit)),
+					telegram.EscapeHTML(e.AuthorName)))
+			}
+		}
+	}
+
+	res := make([]*telegram.Text, 0, 1)
+	var b strings.Builder
+	for _, l := range lines {
+		if b.Len() != 0 && b.Len()+len(l)+1 > telegram.MaxMessageLength {
+			res = append(res, telegram.HTMLText(strings.TrimSpace(b.String())))
+			b.Reset()
+		}
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	if b.Len() != 0 {
+		res = append(res, telegram.HTMLText(strings.TrimSpace(b.String())))
+	}
+
+	return res
+}
+
+func digestPeriod(d *telecollector.Digest) string {
+	const layout = "Jan 2 15:04"
+	loc := d.Until.Location()
+	return fmt.Sprintf("from %s to %s", d.Since.In(loc).Format(layout), d.Until.Format(layout+" MST"))
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const exportUsage = "Usage: /export [jsonl|csv|md] [#tag] [chat:<id>] [author:<id>] [since:YYYY-MM-DD] [until:YYYY-MM-DD]"
+
+// handleExport replies with a document containing every entry matching filters,
+// the export is streamed right into the upload
+func (s *server) handleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		// The whole collection must not leak into group history
+		if ctxVal.Message.Chat.Type != telegram.ChatTypePrivate {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Export is available in a private chat with the bot"))
+			return
+		}
+
+		args := ctxVal.Args()
+		format := telecollector.ExportJSONLines
+		if len(args) != 0 {
+			switch args[0] {
+			case telecollector.ExportJSONLines, telecollector.ExportCSV, telecollector.ExportMarkdown:
+				format, args = args[0], args[1:]
+			}
+		}
+
+		q, err := telecollector.ParseSearchQuery(args)
+		if err != nil {
+			s.replyCommand(w, ctxVal, telegram.PlainText(err.Error()+"\n"+exportUsage))
+			return
+		}
+		q.Chronological = true
+
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := telecollector.Export(s.msgService, q, format, pw)
+			_ = pw.CloseWithError(err)
+		}()
+
+		_, err = s.bot.SendDocument(ctxVal.Message.Chat.ID, ctxVal.Message.ID,
+			telecollector.ExportFileName(format), pr, telegram.PlainText("Collected entries"))
+		// Stop the export if the upload failed halfway
+		_ = pr.Close()
+		if err != nil {
+			log.Printf("server: export command error: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error sending export")
+			return
+		}
+
+		s.respond(w, http.StatusOK, "OK")
+	}
+}
@@ -0,0 +1,366 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	feedPrefix     = "/feed/"
+	feedSize       = 50
+	feedTitleLimit = 100
+
+	feedFormatRSS  = "rss"
+	feedFormatAtom = "atom"
+	feedFormatJSON = "json"
+
+	feedDefaultTitle = "Telecollector"
+)
+
+var feedContentTypes = map[string]string{
+	feedFormatRSS:  "application/rss+xml; charset=utf-8",
+	feedFormatAtom: "application/atom+xml; charset=utf-8",
+	feedFormatJSON: "application/feed+json; charset=utf-8",
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []*atomLink  `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title      string          `xml:"title"`
+	ID         string          `xml:"id"`
+	Updated    string          `xml:"updated"`
+	Published  string          `xml:"published"`
+	Links      []*atomLink     `xml:"link"`
+	Author     atomAuthor      `xml:"author"`
+	Categories []*atomCategory `xml:"category"`
+	Content    atomContent     `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type jsonFeed struct {
+	Version string          `json:"version"`
+	Title   string          `json:"title"`
+	FeedURL string          `json:"feed_url"`
+	Items   []*jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string            `json:"id"`
+	URL           string            `json:"url"`
+	Title         string            `json:"title"`
+	ContentHTML   string            `json:"content_html"`
+	DatePublished string            `json:"date_published"`
+	DateModified  string            `json:"date_modified"`
+	Tags          []string          `json:"tags,omitempty"`
+	Authors       []*jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// routeFeed serves the latest entries as `/feed/rss`, `/feed/atom` or `/feed/json`,
+// `tag` and `chat` URL parameters filter entries and may be repeated
+func (s *server) routeFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := strings.Trim(strings.TrimPrefix(r.URL.Path, feedPrefix), "/")
+		contentType, ok := feedContentTypes[format]
+		if !ok {
+			s.respondAPIError(w, http.StatusNotFound, "Not found")
+			return
+		}
+
+		q := &telecollector.SearchQuery{Limit: feedSize}
+		params := r.URL.Query()
+		for _, t := range params["tag"] {
+			q.Tags = append(q.Tags, telecollector.NormalizeTag(t, false))
+		}
+		for _, c := range params["chat"] {
+			id, err := strconv.ParseInt(c, 10, 64)
+			if err != nil {
+				s.respondAPIError(w, http.StatusBadRequest, apiParamError("chat").Error())
+				return
+			}
+			q.ChatIDs = append(q.ChatIDs, id)
+		}
+
+		entries, err := s.msgService.Search(q)
+		if err != nil {
+			log.Printf("server: feed error searching entries: %s", err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error searching entries")
+			return
+		}
+
+		etag, modified := feedVersion(format, entries)
+		w.Header().Set("ETag", etag)
+		if !modified.IsZero() {
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		}
+		if notModified(r, etag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		title := feedTitle(q)
+		self := feedSelfURL(r)
+
+		var body []byte
+		switch format {
+		case feedFormatRSS:
+			body, err = s.rss(title, self, modified, entries)
+		case feedFormatAtom:
+			body, err = s.atom(title, self, modified, entries)
+		case feedFormatJSON:
+			body, err = s.jsonFeed(title, self, entries)
+		}
+		if err != nil {
+			log.Printf("server: error rendering %s feed: %s", format, err.Error())
+			s.respondAPIError(w, http.StatusInternalServerError, "Error rendering feed")
+			return
+		}
+
+		w.Header().Set("content-type", contentType)
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(body)
+		if err != nil {
+			log.Printf("server: error writing feed: %s", err.Error())
+		}
+	}
+}
+
+func (s *server) rss(title string, self string, modified time.Time, entries []*telecollector.Entry) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        self,
+			Description: "Entries collected from Telegram chats",
+			Items:       make([]*rssItem, 0, len(entries)),
+		},
+	}
+	if !modified.IsZero() {
+		feed.Channel.LastBuildDate = modified.Format(time.RFC1123Z)
+	}
+
+	for _, e := range entries {
+		feed.Channel.Items = append(feed.Channel.Items, &rssItem{
+			Title:       entryTitle(e, feedTitleLimit),
+			Link:        s.entryLink(e),
+			Description: entryHTML(e),
+			Categories:  e.Tags,
+			GUID:        rssGUID{Value: entryGUID(e)},
+			PubDate:     time.Unix(e.Date, 0).UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func (s *server) atom(title string, self string, modified time.Time, entries []*telecollector.Entry) ([]byte, error) {
+	if modified.IsZero() {
+		modified = time.Now().UTC()
+	}
+
+	feed := atomFeed{
+		Title:   title,
+		ID:      self,
+		Updated: modified.Format(time.RFC3339),
+		Links:   []*atomLink{{Rel: "self", Href: self}},
+		Entries: make([]*atomEntry, 0, len(entries)),
+	}
+
+	for _, e := range entries {
+		author := e.AuthorName
+		if len(author) == 0 {
+			author = "Unknown"
+		}
+
+		categories := make([]*atomCategory, 0, len(e.Tags))
+		for _, t := range e.Tags {
+			categories = append(categories, &atomCategory{Term: t})
+		}
+
+		feed.Entries = append(feed.Entries, &atomEntry{
+			Title:      entryTitle(e, feedTitleLimit),
+			ID:         entryGUID(e),
+			Updated:    time.Unix(e.Updated, 0).UTC().Format(time.RFC3339),
+			Published:  time.Unix(e.Date, 0).UTC().Format(time.RFC3339),
+			Links:      []*atomLink{{Rel: "alternate", Href: s.entryLink(e)}},
+			Author:     atomAuthor{Name: author},
+			Categories: categories,
+			Content:    atomContent{Type: "html", Body: entryHTML(e)},
+		})
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func (s *server) jsonFeed(title string, self string, entries []*telecollector.Entry) ([]byte, error) {
+	feed := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   title,
+		FeedURL: self,
+		Items:   make([]*jsonFeedItem, 0, len(entries)),
+	}
+
+	for _, e := range entries {
+		item := &jsonFeedItem{
+			ID:            entryGUID(e),
+			URL:           s.entryLink(e),
+			Title:         entryTitle(e, feedTitleLimit),
+			ContentHTML:   entryHTML(e),
+			DatePublished: time.Unix(e.Date, 0).UTC().Format(time.RFC3339),
+			DateModified:  time.Unix(e.Updated, 0).UTC().Format(time.RFC3339),
+			Tags:          e.Tags,
+		}
+		if len(e.AuthorName) != 0 {
+			item.Authors = []*jsonFeedAuthor{{Name: e.AuthorName}}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+// entryGUID identifies the entry forever regardless of edits and appends
+func entryGUID(e *telecollector.Entry) string {
+	return fmt.Sprintf("urn:telecollector:%d:%d", e.ChatID, e.MessageID)
+}
+
+// entryHTML renders text of the entry and the collector's note as HTML
+func entryHTML(e *telecollector.Entry) string {
+	res := "<p>" + strings.Replace(telegram.EscapeHTML(e.Text), "\n", "<br>", -1) + "</p>"
+	if len(e.Note) != 0 {
+		res += "<p><i>" + strings.Replace(telegram.EscapeHTML(e.Note), "\n", "<br>", -1) + "</i></p>"
+	}
+	return res
+}
+
+// feedVersion returns ETag and the last modification time of the feed,
+// ETag changes whenever an entry is added, updated or forgotten
+func feedVersion(format string, entries []*telecollector.Entry) (string, time.Time) {
+	h := sha256.New()
+	var modified int64
+	_, _ = fmt.Fprintf(h, "%s\n", format)
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(h, "%d:%d:%d\n", e.ChatID, e.MessageID, e.Updated)
+		if e.Updated > modified {
+			modified = e.Updated
+		}
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	if modified == 0 {
+		return etag, time.Time{}
+	}
+	return etag, time.Unix(modified, 0).UTC()
+}
+
+// notModified checks conditional GET headers, If-None-Match takes precedence
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); len(inm) != 0 {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == etag || t == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.IsZero() && !modified.After(ims)
+}
+
+func feedTitle(q *telecollector.SearchQuery) string {
+	title := os.Getenv("FEED_TITLE")
+	if len(title) == 0 {
+		title = feedDefaultTitle
+	}
+
+	if len(q.Tags) != 0 {
+		title += " · " + strings.Join(q.Tags, " ")
+	}
+	return title
+}
+
+func feedSelfURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+// handleForget removes the entry the command replies to from channels
+// and soft-deletes it, only the author of the message or an admin can do that
+func (s *server) handleForget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		target := ctxVal.Message.ReplyToMessage
+		if target == nil {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Reply to the collected message you want to forget"))
+			return
+		}
+
+		requester := ctxVal.Message.Author().ID
+		if target.Author().ID != requester && !s.credService.CheckAdmin(requester) {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Only the author or an admin can forget the message"))
+			return
+		}
+
+		entry, err := s.msgService.FindEntry(target.ID, target.Chat.ID)
+		if err != nil {
+			log.Printf("server: error looking for entry: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error looking for entry")
+			return
+		}
+		if entry == nil {
+			s.replyCommand(w, ctxVal, telegram.PlainText("The message is not collected"))
+			return
+		}
+
+		err = s.forget(entry.ChatID, entry.MessageID)
+		if err != nil {
+			log.Printf("server: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error forgetting entry")
+			return
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText("Forgotten"))
+	}
+}
+
+// retractUntagged forgets the entry when its message is edited
+// so that it has no trigger tag anymore
+func (s *server) retractUntagged(msg *telegram.Message) {
+	entry, err := s.msgService.FindEntry(msg.ID, msg.Chat.ID)
+	if err != nil {
+		log.Printf("server: error looking for entry: %s", err.Error())
+		return
+	}
+
+	if entry == nil || !s.trigService.HasTrigger(entry.ChatID, entry.Tags) {
+		return
+	}
+
+	err = s.forget(entry.ChatID, entry.MessageID)
+	if err != nil {
+		log.Printf("server: %s", err.Error())
+	}
+}
+
+// forget deletes all broadcasts of the entry from channels and soft-deletes it
+func (s *server) forget(chatID int64, msgID int64) error {
+	broadcasts, err := s.msgService.FindBroadcasts(msgID, chatID)
+	if err != nil {
+		return fmt.Errorf("error looking for broadcast message: %w", err)
+	}
+
+	for _, bc := range broadcasts {
+		bot := s.bot.ToChannel(bc.ChannelID)
+		for _, bcID := range bc.MessageIDs {
+			err = bot.DeleteMessage(bcID)
+			if err != nil {
+				return fmt.Errorf("error deleting message: %w", err)
+			}
+		}
+	}
+
+	err = s.msgService.Forget(msgID, chatID)
+	if err != nil {
+		return fmt.Errorf("error forgetting entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+// importErrorsLimit keeps the report readable when the whole chat fails
+const importErrorsLimit = 10
+
+// ImportReport tells what happened to messages of the imported chat
+type ImportReport struct {
+	Chat       *telegram.Chat
+	Messages   int
+	Saved      int
+	Appended   int
+	Broadcast  int
+	Untagged   int
+	OptedOut   int
+	Duplicates int
+	Skipped    int
+	Failed     int
+	Errors     []string
+}
+
+func (r *ImportReport) String() string {
+	res := fmt.Sprintf("%s (%d): %d messages, %d saved, %d appended, %d broadcast, "+
+		"%d untagged, %d opted out, %d already collected, %d skipped, %d failed",
+		r.Chat.Title, r.Chat.ID, r.Messages, r.Saved, r.Appended, r.Broadcast,
+		r.Untagged, r.OptedOut, r.Duplicates, r.Skipped, r.Failed)
+	for _, e := range r.Errors {
+		res += "\n  " + e
+	}
+	return res
+}
+
+// Import replays messages of the chat exported by Telegram Desktop through the
+// same tag matching and saving as live updates, entries which are collected
+// already are left intact so the import can be repeated safely
+func (s *server) Import(dc *telegram.DesktopChat, broadcast bool) (*ImportReport, error) {
+	report := &ImportReport{Chat: dc.Chat, Messages: len(dc.Messages) + dc.Skipped, Skipped: dc.Skipped}
+	if !s.credService.CheckChat(dc.Chat.ID) {
+		return report, fmt.Errorf("chat %d is not followed, follow it before importing", dc.Chat.ID)
+	}
+
+	// Heads saved by this import, appending to entries collected before would repeat their parts
+	fresh := make(map[int64]bool)
+	fail := func(msg *telegram.Message, err error) {
+		report.Failed++
+		if len(report.Errors) < importErrorsLimit {
+			report.Errors = append(report.Errors, fmt.Sprintf("message %d: %s", msg.ID, err.Error()))
+		}
+	}
+
+	for _, msg := range dc.Messages {
+		if cmd, _ := msg.Command(); len(cmd) != 0 {
+			report.Skipped++
+			continue
+		}
+
+		if s.optedOut(msg) {
+			report.OptedOut++
+			continue
+		}
+
+		triggered := s.trigService.IsTriggered(msg)
+		connected, err := s.msgService.CheckConnected(msg)
+		if err != nil {
+			fail(msg, err)
+			continue
+		}
+
+		action := telecollector.ActionSave
+		switch {
+		case connected && !fresh[msg.ID-1]:
+			report.Duplicates++
+			continue
+		case connected:
+			action = telecollector.ActionAppend
+		case !triggered:
+			report.Untagged++
+			continue
+		}
+
+		if action == telecollector.ActionSave {
+			collected, err := s.msgService.IsCollected(msg.ID, msg.Chat.ID)
+			if err != nil {
+				fail(msg, err)
+				continue
+			}
+			if collected {
+				report.Duplicates++
+				continue
+			}
+		}
+
+		ctxVal := &telecollector.MessageContext{
+			Message:            msg,
+			ConnectedMessageID: msg.ID - 1,
+			Action:             action,
+		}
+		text, err := s.msgService.Save(ctxVal)
+		// Forgotten entries were collected before and must stay forgotten
+		if errors.Is(err, telecollector.ErrEntryForgotten) {
+			report.Duplicates++
+			continue
+		}
+		if err != nil {
+			fail(msg, err)
+			continue
+		}
+
+		if action == telecollector.ActionSave {
+			fresh[msg.ID] = true
+			report.Saved++
+		} else {
+			report.Appended++
+		}
+
+		if !broadcast {
+			continue
+		}
+
+		err = s.broadcast(ctxVal, text)
+		if err != nil {
+			fail(msg, err)
+			continue
+		}
+		report.Broadcast++
+	}
+
+	return report, nil
+}
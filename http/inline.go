@@ -0,0 +1,198 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	inlinePageSize   = 20
+	inlineTitleLimit = 64
+	membershipTTL    = 10 * time.Minute
+)
+
+type membership struct {
+	present bool
+	until   time.Time
+}
+
+// membershipCache remembers chat membership of users for a while,
+// so every inline query doesn't turn into a getChatMember per followed chat.
+// Expired entries are swept on insert at most once per TTL.
+type membershipCache struct {
+	mu      sync.Mutex
+	entries map[[2]int64]membership
+	swept   time.Time
+}
+
+func newMembershipCache() *membershipCache {
+	return &membershipCache{entries: make(map[[2]int64]membership), swept: time.Now()}
+}
+
+func (c *membershipCache) get(key [2]int64) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.entries[key]
+	if !ok || !time.Now().Before(m.until) {
+		return false, false
+	}
+	return m.present, true
+}
+
+func (c *membershipCache) put(key [2]int64, present bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.swept) >= membershipTTL {
+		for k, m := range c.entries {
+			if !now.Before(m.until) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+
+	c.entries[key] = membership{present: present, until: now.Add(membershipTTL)}
+}
+
+func (s *server) isChatMember(chatID int64, userID int64) bool {
+	key := [2]int64{chatID, userID}
+	if present, ok := s.members.get(key); ok {
+		return present
+	}
+
+	member, err := s.bot.GetChatMember(chatID, userID)
+	present := err == nil && member.Present()
+	if err != nil {
+		log.Printf("server: error checking chat member: %s", err.Error())
+	}
+
+	s.members.put(key, present)
+	return present
+}
+
+// readableChats returns followed chats the user is a member of,
+// admins can read every followed chat
+func (s *server) readableChats(userID int64) []int64 {
+	followed := s.credService.FollowedChats()
+	if s.credService.CheckAdmin(userID) {
+		return followed
+	}
+
+	res := make([]int64, 0, len(followed))
+	for _, chatID := range followed {
+		if s.isChatMember(chatID, userID) {
+			res = append(res, chatID)
+		}
+	}
+	return res
+}
+
+func (s *server) routeInlineQuery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upd, ok := r.Context().Value(ContextKeyUpdate).(*telegram.Update)
+		if !ok {
+			s.respond(w, http.StatusNotAcceptable, "Unable to route update")
+			return
+		}
+
+		iq := upd.InlineQuery
+		offset, err := strconv.Atoi(iq.Offset)
+		if err != nil {
+			offset = 0
+		}
+
+		results := make([]*telegram.InlineQueryResultArticle, 0)
+		var nextOffset string
+
+		chats := s.readableChats(iq.From.ID)
+		if len(chats) != 0 {
+			entries, err := s.msgService.Search(&telecollector.SearchQuery{
+				Text:    iq.Query,
+				ChatIDs: chats,
+				Offset:  offset,
+				Limit:   inlinePageSize,
+			})
+			if err != nil {
+				log.Printf("server: error searching entries: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Error searching entries")
+				return
+			}
+
+			for _, e := range entries {
+				results = append(results, s.inlineArticle(e))
+			}
+
+			if len(entries) == inlinePageSize {
+				nextOffset = strconv.Itoa(offset + inlinePageSize)
+			}
+		}
+
+		err = s.bot.AnswerInlineQuery(iq.ID, results, nextOffset)
+		if err != nil {
+			log.Printf("server: error answering inline query: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error answering inline query")
+			return
+		}
+
+		s.respond(w, http.StatusOK, "OK")
+	}
+}
+
+// entryLink points to the first broadcast of the entry,
+// or to the original message if it was not broadcasted
+func (s *server) entryLink(e *telecollector.Entry) string {
+	broadcasts, err := s.msgService.FindBroadcasts(e.MessageID, e.ChatID)
+	if err != nil {
+		log.Printf("server: error looking for broadcast message: %s", err.Error())
+	}
+
+	for _, bc := range broadcasts {
+		if len(bc.MessageIDs) != 0 && bc.MessageIDs[0] != 0 {
+			return telegram.MessageLink(bc.ChannelID, "", bc.MessageIDs[0])
+		}
+	}
+
+	return telegram.MessageLink(e.ChatID, "", e.MessageID)
+}
+
+func (s *server) inlineArticle(e *telecollector.Entry) *telegram.InlineQueryResultArticle {
+	link := s.entryLink(e)
+	content := e.Content().Append("\n\n", telegram.PlainText(link))
+	content = telegram.SplitText(content, telegram.MaxMessageLength)[0]
+
+	return &telegram.InlineQueryResultArticle{
+		Type:  "article",
+		ID:    fmt.Sprintf("%d:%d", e.ChatID, e.MessageID),
+		Title: entryTitle(e, inlineTitleLimit),
+		InputMessageContent: &telegram.InputTextMessageContent{
+			MessageText: content.Text,
+			Entities:    content.SendEntities(),
+		},
+		URL:         link,
+		Description: e.Description(),
+	}
+}
+
+// entryTitle is the first line of the entry cut to the limit of runes
+func entryTitle(e *telecollector.Entry, limit int) string {
+	title := strings.TrimSpace(strings.SplitN(e.Text, "\n", 2)[0])
+	if runes := []rune(title); len(runes) > limit {
+		title = string(runes[:limit-1]) + "…"
+	}
+	if len(title) == 0 {
+		title = "Untitled"
+	}
+	return title
+}
@@ -1,9 +1,13 @@
 package http
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
+	"github.com/kalambet/telecollector/telegram"
+
 	"github.com/kalambet/telecollector/telecollector"
 )
 
@@ -16,106 +20,181 @@ func (s *server) handleMessage() http.HandlerFunc {
 		}
 
 		text, err := s.msgService.Save(ctxVal)
+		if errors.Is(err, telecollector.ErrEntryForgotten) {
+			s.respond(w, http.StatusOK, "Entry is forgotten")
+			return
+		}
 		if err != nil {
 			log.Printf("server: error saving message: %s", err.Error())
 			s.respond(w, http.StatusInternalServerError, "Error saving message")
 			return
 		}
 
-		if ctxVal.Action == telecollector.ActionSave {
-			var bcID int64
-			if ctxVal.Message.ReplyToMessage != nil {
-				bcID, err = s.bot.ForwardMessage(ctxVal.Message.ReplyToMessage.Chat.ID, ctxVal.Message.ReplyToMessage.ID)
-				if err != nil {
-					log.Printf("server: error forwarding replied message: %s", err.Error())
-					s.respond(w, http.StatusInternalServerError, "Error forwarding message")
-					return
-				}
-
-				bcID, err = s.bot.ReplyBroadcast(text, bcID)
-				if err != nil {
-					log.Printf("server: error creating reply broadcast: %s", err.Error())
-					s.respond(w, http.StatusInternalServerError, "Error creating reply broadcast")
-					return
-				}
-
-			} else {
-				bcID, err = s.bot.ForwardMessage(ctxVal.Message.Chat.ID, ctxVal.Message.ID)
-				if err != nil {
-					log.Printf("server: error forwarding message: %s", err.Error())
-					s.respond(w, http.StatusInternalServerError, "Error forwarding message")
-					return
-				}
-			}
+		err = s.broadcast(ctxVal, text)
+		if err != nil {
+			log.Printf("server: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error broadcasting message")
+			return
+		}
 
-			err = s.msgService.LogBroadcast(ctxVal.Message, bcID)
-			if err != nil {
-				log.Printf("server: error saving broadcast: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error saving broadcast")
-				return
-			}
-		} else if ctxVal.Action == telecollector.ActionAppend {
-			// Append only for connected messages
-			// So we need to
-			// 1. remove previous broadcast message
-			// 2. forward new one
-			// 3. create replay to the forwarded one with text from the first
-			bcID, err := s.msgService.FindBroadcast(ctxVal.ConnectedMessageID, ctxVal.Message.Chat.ID)
-			if err != nil {
-				log.Printf("server: error looking for broadcast message: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error looking for broadcast message")
-				return
-			}
+		s.respond(w, http.StatusOK, "OK")
+	}
+}
 
-			err = s.bot.DeleteMessage(bcID)
-			if err != nil {
-				log.Printf("server: error deleting message: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error deleting message")
-				return
-			}
+// broadcast spreads the saved entry according to the action,
+// entries of moderated chats go to the review queue instead
+func (s *server) broadcast(ctxVal *telecollector.MessageContext, text *telegram.Text) error {
+	switch ctxVal.Action {
+	case telecollector.ActionSave:
+		if s.credService.CheckModerated(ctxVal.Message.Chat.ID) {
+			return s.enqueueReview(ctxVal, text)
+		}
 
-			bcID, err = s.bot.ForwardMessage(ctxVal.Message.Chat.ID, ctxVal.Message.ID)
+		for _, channelID := range s.destinations(ctxVal.Message) {
+			err := s.broadcastSaved(ctxVal, s.bot.ToChannel(channelID), text)
 			if err != nil {
-				log.Printf("server: error forwarding message: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error forwarding message")
-				return
+				return err
 			}
+		}
+	case telecollector.ActionAppend:
+		return s.broadcastAppended(ctxVal, text)
+	case telecollector.ActionEdit:
+		return s.broadcastEdited(ctxVal, text)
+	}
 
-			err = s.msgService.LogBroadcast(ctxVal.Message, bcID)
-			if err != nil {
-				log.Printf("server: error saving broadcast: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error saving broadcast")
-				return
-			}
+	return nil
+}
 
-			bcID, err = s.bot.ReplyBroadcast(text, bcID)
-			if err != nil {
-				log.Printf("server: error creating reply broadcast: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error creating reply broadcast")
-				return
-			}
+// destinations returns channels the message should be broadcasted to,
+// falling back to the default channel when no route matches
+func (s *server) destinations(msg *telegram.Message) []int64 {
+	channels := s.routeService.Destinations(msg)
+	if len(channels) == 0 {
+		return []int64{s.bot.Channel()}
+	}
 
-			err = s.msgService.LogBroadcast(ctxVal.Message, bcID)
-			if err != nil {
-				log.Printf("server: error saving broadcast: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error saving broadcast")
-				return
-			}
-		} else if ctxVal.Action == telecollector.ActionEdit {
-			bcID, err := s.msgService.FindBroadcast(ctxVal.Message.ID, ctxVal.Message.Chat.ID)
+	return channels
+}
+
+func (s *server) broadcastSaved(ctxVal *telecollector.MessageContext, bot telecollector.Bot, text *telegram.Text) error {
+	var bc *telecollector.Broadcast
+	if replied := s.repliedMessage(ctxVal.Message); replied != nil {
+		head, err := bot.BroadcastMessage(replied)
+		if err != nil {
+			return fmt.Errorf("error forwarding replied message: %w", err)
+		}
+
+		parts, err := bot.ReplyBroadcastChain(text, head[0])
+		if err != nil {
+			return fmt.Errorf("error creating reply broadcast: %w", err)
+		}
+		bc = telecollector.NewBroadcast(bot.Channel(), head, parts)
+		bc.Authors = contentAuthors(replied)
+	} else {
+		head, err := bot.BroadcastMessage(ctxVal.Message)
+		if err != nil {
+			return fmt.Errorf("error forwarding message: %w", err)
+		}
+		bc = telecollector.NewBroadcast(bot.Channel(), head, nil)
+
+		if ctxVal.Note != nil && len(ctxVal.Note.Text) != 0 {
+			parts, err := bot.ReplyBroadcastChain(ctxVal.Note, head[0])
 			if err != nil {
-				log.Printf("server: error looking for broadcast message: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error looking for broadcast message")
-				return
+				return fmt.Errorf("error creating note broadcast: %w", err)
 			}
+			bc = telecollector.NewBroadcast(bot.Channel(), head, parts)
+			bc.Authors = []int64{ctxVal.NoteAuthorID}
+		}
+	}
+
+	err := s.msgService.LogBroadcast(ctxVal.Message, bc)
+	if err != nil {
+		return fmt.Errorf("error saving broadcast: %w", err)
+	}
+
+	return nil
+}
+
+// broadcastAppended is called only for connected messages
+// So for every channel the entry was broadcasted to we need to
+// 1. remove previous broadcast messages
+// 2. forward new one
+// 3. create reply chain to the forwarded one with the whole text
+func (s *server) broadcastAppended(ctxVal *telecollector.MessageContext, text *telegram.Text) error {
+	broadcasts, err := s.msgService.FindBroadcasts(ctxVal.ConnectedMessageID, ctxVal.Message.Chat.ID)
+	if err != nil {
+		return fmt.Errorf("error looking for broadcast message: %w", err)
+	}
 
-			err = s.bot.EditMessage(bcID, text)
+	// Connected entry is stored under the first message,
+	// so its broadcasts are logged there as well
+	connected := *ctxVal.Message
+	connected.ID = ctxVal.ConnectedMessageID
+
+	for _, bc := range broadcasts {
+		bot := s.bot.ToChannel(bc.ChannelID)
+		for _, bcID := range bc.MessageIDs {
+			err = bot.DeleteMessage(bcID)
 			if err != nil {
-				log.Printf("server: error editing message: %s", err.Error())
-				s.respond(w, http.StatusInternalServerError, "Error looking for broadcast message")
-				return
+				return fmt.Errorf("error deleting message: %w", err)
 			}
 		}
-		s.respond(w, http.StatusOK, "OK")
+
+		head, err := bot.BroadcastMessage(ctxVal.Message)
+		if err != nil {
+			return fmt.Errorf("error forwarding message: %w", err)
+		}
+
+		parts, err := bot.ReplyBroadcastChain(text, head[0])
+		if err != nil {
+			return fmt.Errorf("error creating reply broadcast: %w", err)
+		}
+
+		err = s.msgService.LogBroadcast(&connected, telecollector.NewBroadcast(bc.ChannelID, head, parts))
+		if err != nil {
+			return fmt.Errorf("error saving broadcast: %w", err)
+		}
 	}
+
+	return nil
+}
+
+func (s *server) broadcastEdited(ctxVal *telecollector.MessageContext, text *telegram.Text) error {
+	broadcasts, err := s.msgService.FindBroadcasts(ctxVal.Message.ID, ctxVal.Message.Chat.ID)
+	if err != nil {
+		return fmt.Errorf("error looking for broadcast message: %w", err)
+	}
+
+	for _, bc := range broadcasts {
+		if len(bc.MessageIDs) == 0 {
+			continue
+		}
+
+		// Attribution reply stays as it is
+		ids, attribution := bc.MessageIDs, bc.MessageIDs[:0]
+		if bc.Attributed && len(ids) > 1 {
+			ids, attribution = ids[:len(ids)-1], ids[len(ids)-1:]
+		}
+
+		// The first broadcast is the forwarded message itself when
+		// the text follows it as a reply chain
+		head, chain := ids[:0], ids
+		if len(ids) > 1 {
+			head, chain = ids[:1], ids[1:]
+		}
+
+		chain, err = s.bot.ToChannel(bc.ChannelID).EditBroadcastChain(chain, text)
+		if err != nil {
+			return fmt.Errorf("error editing message: %w", err)
+		}
+
+		edited := *bc
+		edited.MessageIDs = append(append(append([]int64{}, head...), chain...), attribution...)
+		err = s.msgService.LogBroadcast(ctxVal.Message, &edited)
+		if err != nil {
+			return fmt.Errorf("error saving broadcast: %w", err)
+		}
+	}
+
+	return nil
 }
@@ -22,8 +22,15 @@ func (s *server) buildContext(next http.HandlerFunc) http.HandlerFunc {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			s.respond(w, http.StatusBadRequest, "Body can't be read")
+			return
+		}
+
+		if s.journal != nil {
+			err = s.journal.Record(body)
+			if err != nil {
+				log.Printf("server: error journaling update: %s", err.Error())
+			}
 		}
-		log.Printf("The Body: \n%s", body)
 
 		d := json.NewDecoder(bytes.NewReader(body))
 		var upd telegram.Update
@@ -86,3 +93,30 @@ func (s *server) onlyWhitelistedChats(next http.HandlerFunc) http.HandlerFunc {
 		}
 	}
 }
+
+// onlyOptedInAuthors skips messages of authors who opted out of collection,
+// the message which would start a new entry gets a reply explaining why
+func (s *server) onlyOptedInAuthors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyMessage).(*telecollector.MessageContext)
+		if !ok {
+			s.respond(w, http.StatusNotAcceptable, "Message context is invalid")
+			return
+		}
+
+		if s.optedOut(ctxVal.Message) {
+			if ctxVal.Action == telecollector.ActionSave {
+				_, err := s.bot.ReplyMessage(telegram.PlainText(optOutSkipped), ctxVal.Message.Chat.ID, ctxVal.Message.ID)
+				if err != nil {
+					log.Printf("server: error replying to opted out message: %s", err.Error())
+				}
+			}
+			s.respond(w, http.StatusOK, "Author opted out of collection")
+			return
+		}
+
+		if next != nil {
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	callbackModeration = "mod"
+
+	reviewApprove = "a"
+	reviewReject  = "r"
+
+	reviewStatusDecided = "Already decided"
+)
+
+var ErrReviewChatMissing = errors.New("server: review chat is not configured")
+
+// enqueueReview posts saved entry of a moderated chat into the review chat
+// with Approve/Reject buttons instead of broadcasting it
+func (s *server) enqueueReview(ctxVal *telecollector.MessageContext, text *telegram.Text) error {
+	if s.reviewChat == 0 {
+		return ErrReviewChatMissing
+	}
+
+	subject := ctxVal.Message
+	if replied := s.repliedMessage(subject); replied != nil {
+		subject = replied
+	}
+
+	bot := s.bot.ToChannel(s.reviewChat)
+	fwdIDs, err := bot.BroadcastMessage(subject)
+	if err != nil {
+		return fmt.Errorf("error forwarding message for review: %w", err)
+	}
+
+	info := telegram.PlainText(fmt.Sprintf("For review from %s:", ctxVal.Message.Attribution())).
+		Append("\n\n", text)
+	if ctxVal.Note != nil && len(ctxVal.Note.Text) != 0 {
+		info = info.Append("\n\nNote: ", ctxVal.Note)
+	}
+
+	chatID, msgID := packInt(ctxVal.Message.Chat.ID), packInt(ctxVal.Message.ID)
+	approve, err := s.callbacks.button("✅ Approve", callbackModeration, reviewApprove, chatID, msgID)
+	if err != nil {
+		return err
+	}
+	reject, err := s.callbacks.button("❌ Reject", callbackModeration, reviewReject, chatID, msgID)
+	if err != nil {
+		return err
+	}
+	kb := &telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]*telegram.InlineKeyboardButton{{approve, reject}},
+	}
+
+	reviewID, err := bot.ReplyKeyboard(telegram.SplitText(info, telegram.MaxMessageLength)[0], s.reviewChat, fwdIDs[0], kb)
+	if err != nil {
+		return fmt.Errorf("error sending review message: %w", err)
+	}
+
+	err = s.modService.Enqueue(ctxVal, reviewID)
+	if err != nil {
+		return fmt.Errorf("error saving review: %w", err)
+	}
+
+	return nil
+}
+
+// handleReviewCallback applies decision of the Approve/Reject button,
+// arguments are decision, chat id and message id of the entry
+func (s *server) handleReviewCallback(cq *telegram.CallbackQuery, args []string) (string, error) {
+	if len(args) != 3 {
+		return "Broken review", nil
+	}
+
+	if !s.credService.CheckAdmin(cq.From.ID) {
+		return "Only admins can moderate", nil
+	}
+
+	chatID, errChat := unpackInt(args[1])
+	msgID, errMsg := unpackInt(args[2])
+	if errChat != nil || errMsg != nil {
+		return "Broken review", nil
+	}
+
+	var decision string
+	switch args[0] {
+	case reviewApprove:
+		decision = telecollector.ReviewApproved
+	case reviewReject:
+		decision = telecollector.ReviewRejected
+	default:
+		return "Broken review", nil
+	}
+
+	status, err := s.decideReview(chatID, msgID, decision, cq.From.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if cq.Message == nil {
+		return status, nil
+	}
+
+	if status == reviewStatusDecided {
+		err = s.bot.EditReplyMarkup(cq.Message.Chat.ID, cq.Message.ID, nil)
+	} else {
+		// Editing text without markup removes the buttons as well
+		done := telegram.EntitiesText(cq.Message.Text, cq.Message.Entities).
+			Append("\n\n", telegram.PlainText(fmt.Sprintf("%s by %s", status, cq.From.FirstName)))
+		err = s.bot.ToChannel(cq.Message.Chat.ID).EditMessage(cq.Message.ID, done)
+	}
+	if err != nil {
+		log.Printf("server: error updating review message: %s", err.Error())
+	}
+
+	return status, nil
+}
+
+// decideReview settles the review and either broadcasts the entry or forgets it,
+// it returns human readable status of the review
+func (s *server) decideReview(chatID int64, msgID int64, decision string, adminID int64) (string, error) {
+	if decision != telecollector.ReviewApproved && decision != telecollector.ReviewRejected {
+		return "", fmt.Errorf("unknown review decision %q", decision)
+	}
+
+	rv, err := s.modService.FindReview(msgID, chatID)
+	if err != nil {
+		return "", fmt.Errorf("error looking for review: %w", err)
+	}
+	if rv == nil || rv.Status != telecollector.ReviewPending {
+		return reviewStatusDecided, nil
+	}
+
+	// Another admin may decide it in between
+	err = s.modService.Decide(msgID, chatID, decision, adminID)
+	if errors.Is(err, telecollector.ErrReviewDecided) {
+		return reviewStatusDecided, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error deciding review: %w", err)
+	}
+
+	if decision == telecollector.ReviewRejected {
+		return "Rejected", s.forget(chatID, msgID)
+	}
+
+	entry, err := s.msgService.FindEntry(msgID, chatID)
+	if err != nil {
+		return "", fmt.Errorf("error looking for entry: %w", err)
+	}
+	if entry == nil {
+		return "Forgotten meanwhile", nil
+	}
+
+	ctxVal := &telecollector.MessageContext{
+		Message:      rv.Message,
+		Action:       telecollector.ActionSave,
+		Note:         rv.Note,
+		NoteAuthorID: rv.NoteAuthorID,
+	}
+	for _, channelID := range s.destinations(rv.Message) {
+		err = s.broadcastSaved(ctxVal, s.bot.ToChannel(channelID), entry.Content())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "Approved", nil
+}
+
+// handleModerate toggles moderation of the current chat: `/moderate on|off`
+func (s *server) handleModerate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			state := "off"
+			if s.credService.CheckModerated(ctxVal.Message.Chat.ID) {
+				state = "on"
+			}
+			s.replyCommand(w, ctxVal, telegram.PlainText("Moderation is "+state+", usage: /moderate on|off"))
+			return
+		}
+
+		err := s.credService.ModerateChat(ctxVal.Message.Chat, args[0] == "on")
+		if err != nil {
+			log.Printf("server: moderate chat command error: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Can not change chat moderation")
+			return
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText("Moderation is "+args[0]))
+	}
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const optOutSkipped = "This message is not collected: its author has opted out of collection. " +
+	"Authors can opt in again by sending /optin to the bot in a private chat."
+
+// handleOptOut lets members keep their messages out of the collection or let them in again,
+// messages forwarded from them are skipped as well
+func (s *server) handleOptOut(out bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		if ctxVal.Message.Chat.Type != telegram.ChatTypePrivate {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Send /"+ctxVal.CommandName+" to the bot in a private chat"))
+			return
+		}
+
+		err := s.credService.OptOut(ctxVal.Message.Author().ID, out)
+		if err != nil {
+			log.Printf("server: %s command error: %s", ctxVal.CommandName, err.Error())
+			s.respond(w, http.StatusInternalServerError, "Can not change collection consent")
+			return
+		}
+
+		reply := "Your messages are collected again when they are tagged or picked"
+		if out {
+			reply = "Your messages are not collected anymore, even when someone tags or picks them. " +
+				"Entries collected before stay, ask admins to erase them. Send /optin to change your mind."
+		}
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
+
+// optedOut reports whether the author of the message or of the forwarded original opted out
+func (s *server) optedOut(msg *telegram.Message) bool {
+	if s.credService.CheckOptedOut(msg.Author().ID) {
+		return true
+	}
+	return msg.ForwardFrom != nil && s.credService.CheckOptedOut(msg.ForwardFrom.ID)
+}
+
+// repliedMessage returns the message the saved one replies to unless its author
+// opted out, then the reply is broadcasted on its own without the original
+func (s *server) repliedMessage(msg *telegram.Message) *telegram.Message {
+	if msg.ReplyToMessage == nil || s.optedOut(msg.ReplyToMessage) {
+		return nil
+	}
+	return msg.ReplyToMessage
+}
+
+// contentAuthors lists people whose content the message carries:
+// its author and the author of the forwarded original
+func contentAuthors(msg *telegram.Message) []int64 {
+	res := []int64{msg.Author().ID}
+	if msg.ForwardFrom != nil {
+		res = append(res, msg.ForwardFrom.ID)
+	}
+	return res
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	reactionsJob      = "reactions"
+	reactionsSchedule = "@hourly"
+)
+
+// scheduleReactionPurge adds the job dropping remembered messages
+// and reactions which fell out of the reaction window
+func (s *server) scheduleReactionPurge() {
+	err := s.scheduler.Add(reactionsJob, reactionsSchedule, func(at time.Time) error {
+		n, err := s.reactService.Purge()
+		if n != 0 {
+			log.Printf("server: %d remembered messages and reactions purged", n)
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("server: error scheduling reactions purge: %s", err.Error())
+	}
+}
+
+func (s *server) routeReaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		upd, ok := r.Context().Value(ContextKeyUpdate).(*telegram.Update)
+		if !ok {
+			s.respond(w, http.StatusNotAcceptable, "Unable to route update")
+			return
+		}
+
+		var chatID, msgID int64
+		if upd.MessageReaction != nil {
+			chatID, msgID = upd.MessageReaction.Chat.ID, upd.MessageReaction.MessageID
+		} else {
+			chatID, msgID = upd.MessageReactionCount.Chat.ID, upd.MessageReactionCount.MessageID
+		}
+
+		triggers := s.reactService.ReactionTriggers(chatID)
+		if len(triggers) == 0 || !s.credService.CheckChat(chatID) {
+			s.respond(w, http.StatusOK, "OK")
+			return
+		}
+
+		counts := make(map[string]int)
+		if upd.MessageReaction != nil {
+			var err error
+			counts, err = s.reactService.React(upd.MessageReaction)
+			if err != nil {
+				log.Printf("server: error saving reaction: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Error saving reaction")
+				return
+			}
+		} else {
+			for _, rc := range upd.MessageReactionCount.Reactions {
+				counts[rc.Type.Key()] = rc.TotalCount
+			}
+		}
+
+		reached := false
+		for _, t := range triggers {
+			if counts[t.Emoji] >= t.Threshold {
+				reached = true
+				break
+			}
+		}
+		if !reached {
+			s.respond(w, http.StatusOK, "OK")
+			return
+		}
+
+		collected, err := s.msgService.IsCollected(msgID, chatID)
+		if err != nil {
+			log.Printf("server: error checking collected message: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error checking collected message")
+			return
+		}
+		if collected {
+			s.respond(w, http.StatusOK, "OK")
+			return
+		}
+
+		msg, err := s.reactService.Recall(chatID, msgID)
+		if err != nil {
+			log.Printf("server: error recalling reacted message: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error recalling reacted message")
+			return
+		}
+		if msg == nil {
+			// Message is older than the reaction window or was never seen
+			s.respond(w, http.StatusOK, "OK")
+			return
+		}
+
+		// The reacted message itself is collected, not the one it replies to
+		msg.ReplyToMessage = nil
+
+		ctx := context.WithValue(r.Context(), ContextKeyMessage, &telecollector.MessageContext{
+			Message:            msg,
+			ConnectedMessageID: msg.ID - 1,
+			UpdateID:           upd.ID,
+			Action:             telecollector.ActionSave,
+		})
+		s.onlyWhitelistedChats(s.onlyOptedInAuthors(s.handleMessage()))(w, r.WithContext(ctx))
+	}
+}
+
+// rememberForReactions keeps not collected messages of followed chats
+// which may still be collected with reactions
+func (s *server) rememberForReactions(msg *telegram.Message) {
+	if !s.credService.CheckChat(msg.Chat.ID) || len(s.reactService.ReactionTriggers(msg.Chat.ID)) == 0 {
+		return
+	}
+
+	// Messages of opted out authors are never collected, so they are not kept either
+	if s.optedOut(msg) {
+		return
+	}
+
+	err := s.reactService.Remember(msg)
+	if err != nil {
+		log.Printf("server: error remembering message: %s", err.Error())
+	}
+}
@@ -0,0 +1,23 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+)
+
+// HandleUpdate feeds the raw update through the same pipeline as webhook
+// requests and returns the status and message the webhook would respond with,
+// handlers which respond nothing leave both empty
+func (s *server) HandleUpdate(raw []byte) (int, string) {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	rec := httptest.NewRecorder()
+	s.buildContext(s.routeUpdate())(rec, req)
+
+	var res response
+	if json.NewDecoder(rec.Body).Decode(&res) != nil {
+		return 0, ""
+	}
+	return res.Status, res.Message
+}
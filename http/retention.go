@@ -0,0 +1,249 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	retentionJob     = "retention"
+	retentionDefault = "@daily"
+
+	journalRetentionDays = "JOURNAL_RETENTION_DAYS"
+
+	retentionUsage = "Usage: /retention list | add <days> [chat=<id>] [tag=<#tag>] [delete|metadata] [broadcasts] | del <policy_id> | dry"
+)
+
+// scheduleRetention adds the purge job run at RETENTION_SCHEDULE, daily by default
+func (s *server) scheduleRetention() {
+	expr := os.Getenv("RETENTION_SCHEDULE")
+	if len(expr) == 0 {
+		expr = retentionDefault
+	}
+
+	err := s.scheduler.Add(retentionJob, expr, func(at time.Time) error {
+		reports, err := s.Purge(false)
+		for _, r := range reports {
+			if r.Entries != 0 || r.Failed != 0 {
+				log.Printf("server: retention %s", r.String())
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		report, err := PurgeJournal(s.journal, false)
+		if len(report) != 0 {
+			log.Printf("server: retention %s", report)
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("server: error scheduling retention: %s", err.Error())
+	}
+}
+
+// Purge applies every retention policy, on dry run nothing is changed and
+// the reports tell what would be purged. Broadcasts are deleted from channels
+// before the entry, so the entry whose broadcast is not deleted is retried next time.
+func (s *server) Purge(dryRun bool) ([]*telecollector.RetentionReport, error) {
+	policies, err := s.retService.Policies()
+	if err != nil {
+		return nil, fmt.Errorf("error reading retention policies: %w", err)
+	}
+
+	reports := make([]*telecollector.RetentionReport, 0, len(policies))
+	for _, p := range policies {
+		report := &telecollector.RetentionReport{Policy: p, DryRun: dryRun}
+		reports = append(reports, report)
+
+		expired, err := s.retService.Expired(p, time.Now().AddDate(0, 0, -p.Days).Unix())
+		if err != nil {
+			return reports, fmt.Errorf("error looking for expired entries: %w", err)
+		}
+
+		for _, e := range expired {
+			deleted, err := s.purgeBroadcasts(p, e, dryRun)
+			report.Broadcasts += deleted
+			if err != nil {
+				log.Printf("server: retention of entry %d in chat %d: %s", e.MessageID, e.ChatID, err.Error())
+				report.Failed++
+				continue
+			}
+
+			if !dryRun {
+				err = s.retService.Purge(p, e.MessageID, e.ChatID)
+				if err != nil {
+					log.Printf("server: error purging entry %d in chat %d: %s", e.MessageID, e.ChatID, err.Error())
+					report.Failed++
+					continue
+				}
+			}
+			report.Entries++
+		}
+	}
+
+	return reports, nil
+}
+
+// PurgeJournal drops updates journaled more than JOURNAL_RETENTION_DAYS ago,
+// they are kept forever when it is not set. On dry run they are only counted.
+// The report is empty when there is nothing to purge.
+func PurgeJournal(j telecollector.UpdateJournal, dryRun bool) (string, error) {
+	days, err := strconv.Atoi(os.Getenv(journalRetentionDays))
+	if j == nil || err != nil || days < 1 {
+		return "", nil
+	}
+
+	before := time.Now().AddDate(0, 0, -days)
+	var n int64
+	verb := "purged"
+	if dryRun {
+		n, err = j.Expired(before)
+		verb = "would purge"
+	} else {
+		n, err = j.Truncate(before)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error purging update journal: %w", err)
+	}
+	if n == 0 {
+		return "", nil
+	}
+
+	return fmt.Sprintf("journal after %d days: %s %d updates", days, verb, n), nil
+}
+
+// purgeBroadcasts deletes channel messages of the entry when the policy asks for it
+func (s *server) purgeBroadcasts(p *telecollector.RetentionPolicy, e *telecollector.Entry, dryRun bool) (int, error) {
+	if !p.Broadcasts {
+		return 0, nil
+	}
+
+	broadcasts, err := s.msgService.FindBroadcasts(e.MessageID, e.ChatID)
+	if err != nil {
+		return 0, fmt.Errorf("error looking for broadcast message: %w", err)
+	}
+
+	deleted := 0
+	for _, bc := range broadcasts {
+		// Dry run may go without the bot at all, so it only counts
+		if dryRun {
+			deleted += len(bc.MessageIDs)
+			continue
+		}
+
+		bot := s.bot.ToChannel(bc.ChannelID)
+		for _, bcID := range bc.MessageIDs {
+			err = bot.DeleteMessage(bcID)
+			if err != nil {
+				return deleted, fmt.Errorf("error deleting message: %w", err)
+			}
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// handleRetention manages retention policies and reports what they would purge now:
+// `/retention list`, `/retention add <days> [chat=..] [tag=..] [delete|metadata] [broadcasts]`,
+// `/retention del <policy_id>`, `/retention dry`
+func (s *server) handleRetention() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		var reply string
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			policies, err := s.retService.Policies()
+			if err != nil {
+				log.Printf("server: list retention command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not list retention policies")
+				return
+			}
+
+			lines := make([]string, 0, len(policies))
+			for _, p := range policies {
+				lines = append(lines, p.String())
+			}
+			reply = "No retention policies, entries are kept forever"
+			if len(lines) != 0 {
+				reply = strings.Join(lines, "\n")
+			}
+		case args[0] == "add":
+			p, err := telecollector.ParseRetentionPolicy(args[1:])
+			if err != nil {
+				reply = err.Error()
+				break
+			}
+
+			err = s.retService.AddPolicy(p)
+			if err != nil {
+				log.Printf("server: add retention command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not add retention policy")
+				return
+			}
+			reply = "Added " + p.String()
+		case args[0] == "del" && len(args) == 2:
+			id, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				reply = "Policy id should be a number"
+				break
+			}
+
+			err = s.retService.RemovePolicy(id)
+			if err != nil {
+				log.Printf("server: delete retention command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not delete retention policy")
+				return
+			}
+			reply = "Deleted"
+		case args[0] == "dry":
+			reports, err := s.Purge(true)
+			if err != nil {
+				log.Printf("server: dry retention command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not check retention policies")
+				return
+			}
+
+			lines := make([]string, 0, len(reports)+1)
+			for _, rep := range reports {
+				lines = append(lines, rep.String())
+			}
+
+			journal, err := PurgeJournal(s.journal, true)
+			if err != nil {
+				log.Printf("server: dry retention command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Can not check update journal")
+				return
+			}
+			if len(journal) != 0 {
+				lines = append(lines, journal)
+			}
+
+			reply = "No retention policies, nothing would be purged"
+			if len(lines) != 0 {
+				reply = strings.Join(lines, "\n")
+			}
+		default:
+			reply = retentionUsage
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
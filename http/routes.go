@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
 
 	"github.com/kalambet/telecollector/telegram"
 
@@ -23,6 +22,11 @@ import (
 func (s *server) routes(secretPath string) {
 	s.router.HandleFunc("/", s.handleStatus())
 	s.router.HandleFunc(fmt.Sprintf("/%s", secretPath), s.buildContext(s.routeUpdate()))
+	s.router.HandleFunc(apiPrefix, s.onlyAPIKey(s.routeAPI()))
+	s.router.HandleFunc(feedPrefix, s.onlyAPIKey(s.routeFeed()))
+
+	s.callbacks.register(callbackModeration, s.handleReviewCallback)
+	s.callbacks.register(callbackSearch, s.handleSearchCallback)
 }
 
 func (s *server) routeUpdate() http.HandlerFunc {
@@ -33,6 +37,21 @@ func (s *server) routeUpdate() http.HandlerFunc {
 			return
 		}
 
+		if upd.InlineQuery != nil {
+			s.routeInlineQuery()(w, r)
+			return
+		}
+
+		if upd.CallbackQuery != nil {
+			s.routeCallback()(w, r)
+			return
+		}
+
+		if upd.MessageReaction != nil || upd.MessageReactionCount != nil {
+			s.routeReaction()(w, r)
+			return
+		}
+
 		action := telecollector.ActionSave
 		var msg *telegram.Message
 		if upd.Message != nil {
@@ -64,14 +83,18 @@ func (s *server) routeUpdate() http.HandlerFunc {
 			ctx = context.WithValue(ctx, ContextKeyCommand, &telecollector.CommandContext{
 				Message:      msg,
 				CommandName:  cmd,
-				CommandPrams: nil,
+				CommandPrams: msg.CommandArgs(),
 				Receiver:     rcvr,
+				UpdateID:     upd.ID,
 			})
 
 			s.routeCommand()(w, r.WithContext(ctx))
 			return
 		}
 
+		// Tags and rules are evaluated first as they need no database roundtrip
+		triggered := s.trigService.IsTriggered(msg)
+
 		connected, err := s.msgService.CheckConnected(msg)
 		if err != nil {
 			log.Printf("server: error checking entry as UOI: %s", err.Error())
@@ -80,12 +103,13 @@ func (s *server) routeUpdate() http.HandlerFunc {
 
 		if connected {
 			action = telecollector.ActionAppend
-		} else {
-			tags := msg.Tags()
-			if sort.SearchStrings(tags, telecollector.TriggerTag) == len(tags) {
-				s.respond(w, http.StatusOK, "OK")
-				return
+		} else if !triggered {
+			if action == telecollector.ActionEdit {
+				s.retractUntagged(msg)
 			}
+			s.rememberForReactions(msg)
+			s.respond(w, http.StatusOK, "OK")
+			return
 		}
 
 		ctx := r.Context()
@@ -96,6 +120,6 @@ func (s *server) routeUpdate() http.HandlerFunc {
 			UpdateID:           upd.ID,
 			Action:             action,
 		})
-		s.onlyWhitelistedChats(s.handleMessage())(w, r.WithContext(ctx))
+		s.onlyWhitelistedChats(s.onlyOptedInAuthors(s.handleMessage()))(w, r.WithContext(ctx))
 	}
 }
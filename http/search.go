@@ -0,0 +1,189 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	callbackSearch = "srch"
+
+	searchPageSize     = 5
+	searchSnippetLimit = 200
+
+	searchUsage = "Usage: /search [#tag] [chat:<id>] [author:<id>] [since:YYYY-MM-DD] [until:YYYY-MM-DD] words..."
+)
+
+// handleSearch replies with the first page of entries matching the query,
+// in groups only the group itself is searched, in private chats every chat the user is a member of
+func (s *server) handleSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		args := ctxVal.Args()
+		if len(args) == 0 {
+			s.replyCommand(w, ctxVal, telegram.PlainText(searchUsage))
+			return
+		}
+
+		text, kb, err := s.searchPage(ctxVal.Message, ctxVal.Message.Author().ID, 0)
+		if err != nil {
+			log.Printf("server: search command error: %s", err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error searching entries")
+			return
+		}
+
+		_, err = s.bot.ReplyKeyboard(text, ctxVal.Message.Chat.ID, ctxVal.Message.ID, kb)
+		if err != nil {
+			log.Printf("server: error sending `%s` response: %s", ctxVal.CommandName, err.Error())
+			s.respond(w, http.StatusInternalServerError, "Error sending command response")
+			return
+		}
+		s.respond(w, http.StatusOK, "OK")
+	}
+}
+
+// handleSearchCallback turns the page of search results,
+// the query is read again from the command message the results reply to
+func (s *server) handleSearchCallback(cq *telegram.CallbackQuery, args []string) (string, error) {
+	if len(args) != 1 || cq.Message == nil || cq.Message.ReplyToMessage == nil {
+		return "Search is not available anymore", nil
+	}
+
+	cmd := cq.Message.ReplyToMessage
+	if cmd.Author().ID != cq.From.ID {
+		return "Only the one who searched can turn pages", nil
+	}
+
+	offset, err := unpackInt(args[0])
+	if err != nil {
+		return "Broken page", nil
+	}
+
+	text, kb, err := s.searchPage(cmd, cq.From.ID, int(offset))
+	if err != nil {
+		return "", err
+	}
+
+	err = s.bot.EditKeyboard(text, cq.Message.Chat.ID, cq.Message.ID, kb)
+	if err != nil {
+		return "", fmt.Errorf("error updating search results: %w", err)
+	}
+
+	return "", nil
+}
+
+// searchPage runs the query of the /search command message on behalf of the user
+// and renders the page starting at offset with Prev/Next buttons
+func (s *server) searchPage(cmd *telegram.Message, userID int64, offset int) (*telegram.Text, *telegram.InlineKeyboardMarkup, error) {
+	q, err := telecollector.ParseSearchQuery(cmd.CommandArgs())
+	if err != nil {
+		return telegram.PlainText(err.Error() + "\n" + searchUsage), nil, nil
+	}
+
+	q.ChatIDs = s.searchableChats(cmd.Chat, userID, q.ChatIDs)
+	if len(q.ChatIDs) == 0 {
+		return telegram.PlainText("There are no chats you can search in"), nil, nil
+	}
+
+	// One more entry tells whether there is the next page
+	q.Offset, q.Limit = offset, searchPageSize+1
+	entries, err := s.msgService.Search(q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error searching entries: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return telegram.PlainText("Nothing found"), nil, nil
+	}
+
+	more := len(entries) > searchPageSize
+	if more {
+		entries = entries[:searchPageSize]
+	}
+
+	lines := make([]string, 0, len(entries))
+	for i, e := range entries {
+		lines = append(lines, fmt.Sprintf("<b>%d.</b> %s\n<i>%s</i> · <a href=\"%s\">open</a>",
+			offset+i+1, searchSnippet(e), telegram.EscapeHTML(e.Description()), telegram.EscapeHTML(s.entryLink(e))))
+	}
+
+	row := make([]*telegram.InlineKeyboardButton, 0, 2)
+	if offset > 0 {
+		prevOffset := offset - searchPageSize
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		prev, err := s.callbacks.button("◀ Prev", callbackSearch, packInt(int64(prevOffset)))
+		if err != nil {
+			return nil, nil, err
+		}
+		row = append(row, prev)
+	}
+	if more {
+		next, err := s.callbacks.button("Next ▶", callbackSearch, packInt(int64(offset+searchPageSize)))
+		if err != nil {
+			return nil, nil, err
+		}
+		row = append(row, next)
+	}
+
+	var kb *telegram.InlineKeyboardMarkup
+	if len(row) != 0 {
+		kb = &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]*telegram.InlineKeyboardButton{row}}
+	}
+
+	return telegram.HTMLText(strings.Join(lines, "\n\n")), kb, nil
+}
+
+// searchableChats narrows requested chats down to the ones the user may read
+func (s *server) searchableChats(chat *telegram.Chat, userID int64, requested []int64) []int64 {
+	readable := []int64{chat.ID}
+	if chat.Type == telegram.ChatTypePrivate {
+		readable = s.readableChats(userID)
+	} else if !s.credService.CheckChat(chat.ID) {
+		return nil
+	}
+
+	if len(requested) == 0 {
+		return readable
+	}
+
+	allowed := make(map[int64]bool, len(readable))
+	for _, id := range readable {
+		allowed[id] = true
+	}
+
+	res := make([]int64, 0, len(requested))
+	for _, id := range requested {
+		if allowed[id] {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// searchSnippet renders highlighted fragment of the entry as HTML,
+// entries found by filters only are shown by their beginning
+func searchSnippet(e *telecollector.Entry) string {
+	if len(e.Highlight) == 0 {
+		text := []rune(strings.TrimSpace(e.Text))
+		if len(text) > searchSnippetLimit {
+			return telegram.EscapeHTML(string(text[:searchSnippetLimit-1])) + "…"
+		}
+		return telegram.EscapeHTML(string(text))
+	}
+
+	return strings.NewReplacer(telecollector.HighlightStart, "<b>", telecollector.HighlightStop, "</b>").
+		Replace(telegram.EscapeHTML(e.Highlight))
+}
@@ -10,10 +10,12 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/kalambet/telecollector/store"
+	"github.com/kalambet/telecollector/telegram"
 
 	"github.com/kalambet/telecollector/telecollector"
 )
@@ -31,11 +33,25 @@ const (
 type ContextKey string
 
 type server struct {
-	port        int
-	router      *http.ServeMux
-	msgService  telecollector.MessageService
-	credService telecollector.CredentialService
-	bot         telecollector.Bot
+	port         int
+	router       *http.ServeMux
+	msgService   telecollector.MessageService
+	credService  telecollector.CredentialService
+	routeService telecollector.RoutingService
+	trigService  telecollector.TriggerService
+	reactService telecollector.ReactionService
+	modService   telecollector.ModerationService
+	keyService   telecollector.APIKeyService
+	retService   telecollector.RetentionService
+	privService  telecollector.PrivacyService
+	journal      telecollector.UpdateJournal
+	reviewChat   int64
+	digests      []*telecollector.DigestSchedule
+	digestChat   int64
+	scheduler    *telecollector.Scheduler
+	callbacks    *callbackRouter
+	members      *membershipCache
+	bot          telecollector.Bot
 }
 
 type response struct {
@@ -43,34 +59,89 @@ type response struct {
 	Message string `json:"message"`
 }
 
-func NewServer(ms telecollector.MessageService, cred telecollector.CredentialService) (*server, error) {
+func NewServer(svc *telecollector.Services) (*server, error) {
 	portStr := os.Getenv("PORT")
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
 		return nil, err
 	}
 
-	res := &server{
-		port:        port,
-		msgService:  ms,
-		credService: cred,
-		router:      http.NewServeMux(),
-	}
-
 	token := os.Getenv("TG_TOKEN")
 	if len(token) == 0 {
 		return nil, ErrTGTokenEmpty
 	}
-	res.routes(token)
 
-	res.bot, err = telecollector.NewBot(token)
+	bot, err := telecollector.NewBot(token)
 	if err != nil {
 		return nil, err
 	}
 
+	res := newServer(svc, bot, token)
+	res.port = port
+
+	// Only the serving process runs periodic jobs
+	res.scheduler = telecollector.NewScheduler(svc.Jobs)
+	res.scheduleDigests()
+	res.scheduleRetention()
+	res.scheduleReactionPurge()
+
+	// Webhook is registered only when its URL is known, otherwise
+	// it is expected to be set up manually with the same update types
+	webhook := os.Getenv("TG_WEBHOOK_URL")
+	if len(webhook) != 0 {
+		err = res.bot.SetWebhook(fmt.Sprintf("%s/%s", strings.TrimRight(webhook, "/"), token), telegram.AllowedUpdates)
+		if err != nil {
+			log.Printf("server: error setting webhook: %s", err.Error())
+		}
+	}
+
 	return res, nil
 }
 
+// NewOfflineServer builds the server which handles updates and imports handed
+// to it directly instead of serving webhooks, every Telegram call goes to the bot
+func NewOfflineServer(svc *telecollector.Services, bot telecollector.Bot) *server {
+	return newServer(svc, bot, os.Getenv("TG_TOKEN"))
+}
+
+func newServer(svc *telecollector.Services, bot telecollector.Bot, token string) *server {
+	res := &server{
+		msgService:   svc.Messages,
+		credService:  svc.Credentials,
+		routeService: svc.Routing,
+		trigService:  svc.Triggers,
+		reactService: svc.Reactions,
+		modService:   svc.Moderation,
+		keyService:   svc.APIKeys,
+		retService:   svc.Retention,
+		privService:  svc.Privacy,
+		journal:      svc.Journal,
+		members:      newMembershipCache(),
+		router:       http.NewServeMux(),
+		bot:          bot,
+	}
+
+	var err error
+	res.reviewChat, err = strconv.ParseInt(os.Getenv("TG_REVIEW_CHAT"), 10, 64)
+	if err != nil {
+		log.Printf("server: review chat is not configured, moderated chats can not be collected")
+		res.reviewChat = 0
+	}
+
+	// Callback payloads are signed with the token unless a dedicated secret is set
+	secret := os.Getenv("CALLBACK_SECRET")
+	if len(secret) == 0 {
+		secret = token
+	}
+	res.callbacks = newCallbackRouter(secret)
+
+	res.digests, res.digestChat = digestConfig()
+
+	res.routes(token)
+
+	return res
+}
+
 func (s *server) StartServer() {
 	srv := http.Server{
 		Handler: s.router,
@@ -82,6 +153,8 @@ func (s *server) StartServer() {
 		}
 	}()
 
+	s.scheduler.Start()
+
 	// Setting up signal capturing
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
@@ -91,6 +164,7 @@ func (s *server) StartServer() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer s.stopServer()
+	defer s.scheduler.Stop()
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("server: error while shutdown: %s\n", err.Error())
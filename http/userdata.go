@@ -0,0 +1,207 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	userDataAuditLimit = 20
+
+	userDataUsage = "Usage: /userdata export <author_id> | erase <author_id> [confirm] | anonymize <author_id> [confirm] | audit"
+)
+
+// userData collects everything stored about the author, the update journal included
+func (s *server) userData(authorID int64) (*telecollector.UserData, error) {
+	d, err := s.privService.UserData(authorID)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting user data: %w", err)
+	}
+
+	d.Updates = make([]json.RawMessage, 0)
+	if s.journal != nil {
+		d.Updates, err = s.journal.UserUpdates(authorID)
+		if err != nil {
+			return nil, fmt.Errorf("error reading update journal: %w", err)
+		}
+	}
+
+	return d, nil
+}
+
+// ExportUserData writes everything stored about the author as JSON and logs it to the audit log
+func (s *server) ExportUserData(adminID int64, authorID int64, w io.Writer) (*telecollector.UserData, error) {
+	d, err := s.userData(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.privService.Audit(adminID, telecollector.AuditUserExport, authorID, d.String())
+	if err != nil {
+		return d, fmt.Errorf("error writing audit log: %w", err)
+	}
+
+	return d, nil
+}
+
+// EraseUserData deletes broadcasts of the author from channels and then erases
+// or anonymizes them in the journal and the store along with the audit record.
+// Broadcasts which can not be deleted are reported to be deleted by hand,
+// they must not keep the author from being erased.
+func (s *server) EraseUserData(adminID int64, authorID int64, anonymize bool) (*telecollector.ErasureReport, error) {
+	broadcasts, err := s.privService.AuthorBroadcasts(authorID)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for broadcasts: %w", err)
+	}
+
+	deleted := 0
+	failed := make([]string, 0)
+	for _, bc := range broadcasts {
+		bot := s.bot.ToChannel(bc.ChannelID)
+		for _, bcID := range bc.MessageIDs {
+			err = bot.DeleteMessage(bcID)
+			if err != nil {
+				log.Printf("server: error deleting broadcast of author %d: %s", authorID, err.Error())
+				failed = append(failed, telegram.MessageLink(bc.ChannelID, "", bcID))
+				continue
+			}
+			deleted++
+		}
+	}
+
+	report := &telecollector.ErasureReport{
+		AuthorID:         authorID,
+		Anonymized:       anonymize,
+		Broadcasts:       deleted,
+		BroadcastsFailed: failed,
+	}
+
+	// Journal may be a file, so it is erased before the store
+	// and the erasure is retried as a whole when it fails
+	if s.journal != nil {
+		report.Updates, err = s.journal.EraseUser(authorID)
+		if err != nil {
+			return nil, fmt.Errorf("error erasing update journal: %w", err)
+		}
+	}
+
+	err = s.privService.Erase(report, adminID)
+	if err != nil {
+		return nil, fmt.Errorf("error erasing user data: %w", err)
+	}
+
+	return report, nil
+}
+
+// handleUserData exports and erases data of the author on their request:
+// `/userdata export <author_id>`, `/userdata erase|anonymize <author_id> [confirm]`, `/userdata audit`.
+// Erasure without confirm only tells what is going to be removed.
+func (s *server) handleUserData() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctxVal, ok := r.Context().Value(ContextKeyCommand).(*telecollector.CommandContext)
+		if !ok {
+			s.respond(w, http.StatusInternalServerError, "Command context is invalid")
+			return
+		}
+
+		// Personal data must not leak into group history
+		if ctxVal.Message.Chat.Type != telegram.ChatTypePrivate {
+			s.replyCommand(w, ctxVal, telegram.PlainText("User data is available in a private chat with the bot"))
+			return
+		}
+
+		adminID := ctxVal.Message.Author().ID
+		args := ctxVal.Args()
+		if len(args) == 1 && args[0] == "audit" {
+			s.replyAuditLog(w, ctxVal)
+			return
+		}
+
+		if len(args) < 2 {
+			s.replyCommand(w, ctxVal, telegram.PlainText(userDataUsage))
+			return
+		}
+		authorID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			s.replyCommand(w, ctxVal, telegram.PlainText("Author id should be a number"))
+			return
+		}
+
+		var reply string
+		switch {
+		case args[0] == "export" && len(args) == 2:
+			pr, pw := io.Pipe()
+			go func() {
+				_, err := s.ExportUserData(adminID, authorID, pw)
+				_ = pw.CloseWithError(err)
+			}()
+
+			_, err = s.bot.SendDocument(ctxVal.Message.Chat.ID, ctxVal.Message.ID,
+				fmt.Sprintf("userdata-%d.json", authorID), pr, telegram.PlainText(fmt.Sprintf("Data of author %d", authorID)))
+			_ = pr.Close()
+			if err != nil {
+				log.Printf("server: user data export command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Error sending user data")
+				return
+			}
+			s.respond(w, http.StatusOK, "OK")
+			return
+		case (args[0] == "erase" || args[0] == "anonymize") && len(args) == 2:
+			d, err := s.userData(authorID)
+			if err != nil {
+				log.Printf("server: user data command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Error collecting user data")
+				return
+			}
+			reply = fmt.Sprintf("Found %s.\nRepeat with `confirm` at the end to %s.", d.String(), args[0])
+		case (args[0] == "erase" || args[0] == "anonymize") && len(args) == 3 && args[2] == "confirm":
+			report, err := s.EraseUserData(adminID, authorID, args[0] == "anonymize")
+			if err != nil {
+				log.Printf("server: user data erase command error: %s", err.Error())
+				s.respond(w, http.StatusInternalServerError, "Error erasing user data")
+				return
+			}
+			reply = report.String()
+		default:
+			reply = userDataUsage
+		}
+
+		s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+	}
+}
+
+func (s *server) replyAuditLog(w http.ResponseWriter, ctxVal *telecollector.CommandContext) {
+	records, err := s.privService.AuditLog(userDataAuditLimit)
+	if err != nil {
+		log.Printf("server: audit log command error: %s", err.Error())
+		s.respond(w, http.StatusInternalServerError, "Error reading audit log")
+		return
+	}
+
+	lines := make([]string, 0, len(records))
+	for _, rec := range records {
+		lines = append(lines, rec.String())
+	}
+	reply := "Audit log is empty"
+	if len(lines) != 0 {
+		reply = strings.Join(lines, "\n")
+	}
+
+	s.replyCommand(w, ctxVal, telegram.PlainText(reply))
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+// deletingBot remembers messages deleted from every channel
+type deletingBot struct {
+	telecollector.Bot
+	channel int64
+	deleted map[int64][]int64
+}
+
+func (b *deletingBot) ToChannel(channelID int64) telecollector.Bot {
+	return &deletingBot{Bot: b.Bot.ToChannel(channelID), channel: channelID, deleted: b.deleted}
+}
+
+func (b *deletingBot) DeleteMessage(msgID int64) error {
+	b.deleted[b.channel] = append(b.deleted[b.channel], msgID)
+	return nil
+}
+
+type loggedBroadcast struct {
+	entryAuthor int64
+	bc          *telecollector.Broadcast
+}
+
+// broadcastLog keeps broadcasts in memory and looks for the ones
+// of the author the way the store does
+type broadcastLog struct {
+	telecollector.MessageService
+	telecollector.PrivacyService
+	telecollector.CredentialService
+	logged []*loggedBroadcast
+}
+
+func (l *broadcastLog) LogBroadcast(msg *telegram.Message, bc *telecollector.Broadcast) error {
+	l.logged = append(l.logged, &loggedBroadcast{entryAuthor: msg.Author().ID, bc: bc})
+	return nil
+}
+
+func (l *broadcastLog) AuthorBroadcasts(authorID int64) ([]*telecollector.Broadcast, error) {
+	res := make([]*telecollector.Broadcast, 0)
+	for _, lb := range l.logged {
+		carried := false
+		for _, id := range lb.bc.Authors {
+			carried = carried || id == authorID
+		}
+		if lb.entryAuthor == authorID || carried {
+			res = append(res, lb.bc)
+		}
+	}
+	return res, nil
+}
+
+func (l *broadcastLog) Erase(report *telecollector.ErasureReport, adminID int64) error {
+	return nil
+}
+
+func (l *broadcastLog) CheckOptedOut(authorID int64) bool {
+	return false
+}
+
+func testMessage(id int64, authorID int64, text string) *telegram.Message {
+	return &telegram.Message{
+		ID:   id,
+		From: &telegram.User{ID: authorID, FirstName: "Test"},
+		Chat: &telegram.Chat{ID: -100},
+		Text: text,
+	}
+}
+
+func TestEraseRepliedBroadcast(t *testing.T) {
+	const (
+		channelID = -200
+		author    = 7
+		replier   = 8
+		collector = 9
+	)
+
+	store := &broadcastLog{}
+	bot := &deletingBot{Bot: telecollector.NewFakeBot("test"), deleted: make(map[int64][]int64)}
+	s := &server{msgService: store, privService: store, credService: store, bot: bot}
+
+	// Someone else replies to the author's message, the broadcast is headed by the author's message
+	reply := testMessage(11, replier, "#read this")
+	reply.ReplyToMessage = testMessage(10, author, "original thought")
+	err := s.broadcastSaved(&telecollector.MessageContext{Message: reply, Action: telecollector.ActionSave},
+		s.bot.ToChannel(channelID), telegram.PlainText(reply.Text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replied := store.logged[0].bc.MessageIDs
+
+	// Entries of others without content of the author stay in the channel
+	err = s.broadcastSaved(&telecollector.MessageContext{Message: testMessage(12, replier, "#read mine"), Action: telecollector.ActionSave},
+		s.bot.ToChannel(channelID), telegram.PlainText("#read mine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The note of the collector makes the broadcast theirs as well
+	err = s.broadcastSaved(&telecollector.MessageContext{
+		Message:      testMessage(13, replier, "picked"),
+		Action:       telecollector.ActionSave,
+		Note:         telegram.PlainText("worth reading"),
+		NoteAuthorID: collector,
+	}, s.bot.ToChannel(channelID), telegram.PlainText("picked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noted := store.logged[2].bc.MessageIDs
+
+	if len(replied) != 2 || len(noted) != 2 {
+		t.Fatalf("broadcasts are %v and %v, want message and reply each", replied, noted)
+	}
+
+	report, err := s.EraseUserData(1, author, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bot.deleted[channelID]; !reflect.DeepEqual(got, replied) {
+		t.Errorf("erasing the author deleted %v, want %v", got, replied)
+	}
+	if report.Broadcasts != len(replied) {
+		t.Errorf("report counts %d broadcast messages, want %d", report.Broadcasts, len(replied))
+	}
+
+	bot.deleted[channelID] = nil
+	_, err = s.EraseUserData(1, collector, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bot.deleted[channelID]; !reflect.DeepEqual(got, noted) {
+		t.Errorf("erasing the collector deleted %v, want %v", got, noted)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kalambet/telecollector/http"
+	"github.com/kalambet/telecollector/telecollector"
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const commandImport = "import"
+
+// runImport implements `telecollector import [-broadcast] result.json`
+// for Telegram Desktop exports of a single chat or the whole account
+func runImport(args []string) error {
+	fs := flag.NewFlagSet(commandImport, flag.ExitOnError)
+	broadcast := fs.Bool("broadcast", false, "broadcast imported entries like live ones")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("path to result.json is required")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chats, err := telegram.ParseDesktopExport(f)
+	if err != nil {
+		return err
+	}
+
+	var bot telecollector.Bot
+	if *broadcast {
+		bot, err = telecollector.NewBot(os.Getenv("TG_TOKEN"))
+		if err != nil {
+			return err
+		}
+	}
+
+	importer := http.NewOfflineServer(&svc, bot)
+	for _, dc := range chats {
+		report, err := importer.Import(dc, *broadcast)
+		if err != nil {
+			log.Printf("import: %s", err.Error())
+			continue
+		}
+		log.Printf("import: %s", report.String())
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/kalambet/telecollector/telecollector"
 
@@ -10,24 +11,114 @@ import (
 	"github.com/kalambet/telecollector/store"
 )
 
-var msg telecollector.MessageService
-var cred telecollector.CredentialService
+var svc telecollector.Services
 
-func init() {
+// initServices creates services against the store,
+// replay picks the store before that
+func initServices() {
 	var err error
-	msg, err = store.NewMessagesService()
+	svc.Messages, err = store.NewMessagesService()
 	if err != nil {
 		log.Fatalf("stratup: error initializing messaging service: %s", err.Error())
 	}
 
-	cred, err = store.NewCrenetialService()
+	svc.Credentials, err = store.NewCrenetialService()
 	if err != nil {
 		log.Fatalf("stratup: error initializing credential service: %s", err.Error())
 	}
+
+	svc.Routing, err = store.NewRoutingService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing routing service: %s", err.Error())
+	}
+
+	svc.Triggers, err = store.NewTriggerService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing trigger service: %s", err.Error())
+	}
+
+	svc.Reactions, err = store.NewReactionService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing reaction service: %s", err.Error())
+	}
+
+	svc.Moderation, err = store.NewModerationService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing moderation service: %s", err.Error())
+	}
+
+	svc.APIKeys, err = store.NewAPIKeyService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing api key service: %s", err.Error())
+	}
+
+	svc.Retention, err = store.NewRetentionService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing retention service: %s", err.Error())
+	}
+
+	svc.Privacy, err = store.NewPrivacyService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing privacy service: %s", err.Error())
+	}
+
+	svc.Jobs, err = store.NewJobService()
+	if err != nil {
+		log.Fatalf("stratup: error initializing job service: %s", err.Error())
+	}
+
+	svc.Journal, err = store.NewUpdateJournal()
+	if err != nil {
+		log.Fatalf("stratup: error initializing update journal: %s", err.Error())
+	}
 }
 
 func main() {
-	srv, err := http.NewServer(msg, cred)
+	if len(os.Args) > 1 && os.Args[1] == commandReplay {
+		err := runReplay(os.Args[2:])
+		if err != nil {
+			log.Fatalf("replay: %s", err.Error())
+		}
+		return
+	}
+
+	initServices()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case telecollector.CommandExport:
+			err := runExport(os.Args[2:])
+			if err != nil {
+				log.Fatalf("export: %s", err.Error())
+			}
+			return
+		case commandVault:
+			err := runVault(os.Args[2:])
+			if err != nil {
+				log.Fatalf("vault: %s", err.Error())
+			}
+			return
+		case commandUserData:
+			err := runUserData(os.Args[2:])
+			if err != nil {
+				log.Fatalf("userdata: %s", err.Error())
+			}
+			return
+		case commandPurge:
+			err := runPurge(os.Args[2:])
+			if err != nil {
+				log.Fatalf("purge: %s", err.Error())
+			}
+			return
+		case commandImport:
+			err := runImport(os.Args[2:])
+			if err != nil {
+				log.Fatalf("import: %s", err.Error())
+			}
+			return
+		}
+	}
+
+	srv, err := http.NewServer(&svc)
 	if err != nil {
 		log.Fatalf("startup: error initializing server: %s", err.Error())
 	}
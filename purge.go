@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kalambet/telecollector/http"
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const commandPurge = "purge"
+
+// runPurge implements `telecollector purge [-dry-run]` which applies
+// retention policies and the journal retention at once instead of waiting for the scheduled job
+func runPurge(args []string) error {
+	fs := flag.NewFlagSet(commandPurge, flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be purged without changing anything")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Broadcasts can only be deleted on behalf of the bot
+	var bot telecollector.Bot
+	if !*dryRun {
+		bot, err = telecollector.NewBot(os.Getenv("TG_TOKEN"))
+		if err != nil {
+			return err
+		}
+	}
+
+	reports, err := http.NewOfflineServer(&svc, bot).Purge(*dryRun)
+	for _, r := range reports {
+		log.Printf("purge: %s", r.String())
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(reports) == 0 {
+		log.Printf("purge: no retention policies")
+	}
+
+	journal, err := http.PurgeJournal(svc.Journal, *dryRun)
+	if len(journal) != 0 {
+		log.Printf("purge: %s", journal)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/kalambet/telecollector/http"
+	"github.com/kalambet/telecollector/store"
+	"github.com/kalambet/telecollector/telecollector"
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const commandReplay = "replay"
+
+// runReplay implements `telecollector replay -database url|-confirm [-since time] [-bot name] journal`,
+// updates of the journal go through the routing against the store at -database
+// while every Telegram call is only logged. Postgres journal is read from DATABASE_URL.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet(commandReplay, flag.ExitOnError)
+	since := fs.String("since", "", "replay updates received since RFC 3339 time")
+	username := fs.String("bot", "telecollector_bot", "bot username commands are addressed to")
+	admin := fs.Bool("admin", false, "report every user as chat administrator")
+	database := fs.String("database", "", "URL of the store to replay into")
+	confirm := fs.Bool("confirm", false, "replay into the store at DATABASE_URL when -database is not set")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	// Replayed updates are saved for real, production store must not get them by accident
+	if len(*database) == 0 && !*confirm {
+		return errors.New("updates are written into the store, pass -database with a scratch database or -confirm to use DATABASE_URL")
+	}
+	if fs.NArg() != 1 {
+		return errors.New("journal file path or `postgres` is required")
+	}
+
+	var from time.Time
+	if len(*since) != 0 {
+		from, err = time.Parse(time.RFC3339, *since)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Journal is opened before the store is switched, so it keeps reading the original database
+	journal, err := store.OpenUpdateJournal(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if len(*database) != 0 {
+		err = store.Connect(*database)
+		if err != nil {
+			return err
+		}
+	}
+	initServices()
+
+	bot := telecollector.NewFakeBot(*username)
+	if *admin {
+		bot.MemberStatus = telegram.ChatMemberAdministrator
+	}
+
+	// Replayed updates must not be journaled once again
+	offline := svc
+	offline.Journal = nil
+	srv := http.NewOfflineServer(&offline, bot)
+	count := 0
+	err = journal.Replay(from, func(at time.Time, raw []byte) error {
+		count++
+		status, msg := srv.HandleUpdate(raw)
+		log.Printf("replay: update #%d received %s: %d %s", count, at.Format(time.RFC3339), status, msg)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("replay: %d updates replayed", count)
+	return nil
+}
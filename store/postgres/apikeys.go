@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	apiTokenPrefix = "tc_"
+	apiTokenBytes  = 24
+
+	createAPIKeys = `
+create table api_keys(
+    id bigserial primary key,
+    name text not null,
+    hash text not null unique,
+    created_by bigint not null,
+    created timestamp not null default now(),
+    last_used timestamp,
+    revoked_at timestamp
+);`
+
+	insertAPIKey = `
+insert into 
+    api_keys (name, hash, created_by) 
+    values ($1, $2, $3) returning id, created;`
+
+	queryAPIKeys = `
+select id, name, created_by, created, last_used from api_keys 
+    where revoked_at is null order by id;`
+
+	revokeAPIKey = `update api_keys set revoked_at = now() where id = $1 and revoked_at is null;`
+
+	// Checking the key marks it as used at once
+	touchAPIKey = `
+update api_keys set last_used = now() 
+    where hash = $1 and revoked_at is null 
+    returning id, name, created_by, created, last_used;`
+)
+
+type apiKeyService struct{}
+
+func NewAPIKeyService() (telecollector.APIKeyService, error) {
+	err := gracefulCreateTable("api_keys", createAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiKeyService{}, nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ks *apiKeyService) CreateKey(name string, adminID int64) (string, *telecollector.APIKey, error) {
+	raw := make([]byte, apiTokenBytes)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	token := apiTokenPrefix + hex.EncodeToString(raw)
+
+	k := &telecollector.APIKey{Name: name, CreatedBy: adminID}
+	err = db.QueryRow(insertAPIKey, name, hashAPIToken(token), adminID).Scan(&k.ID, &k.Created)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, k, nil
+}
+
+func (ks *apiKeyService) Keys() ([]*telecollector.APIKey, error) {
+	rows, err := db.Query(queryAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*telecollector.APIKey, 0)
+	for rows.Next() {
+		k := telecollector.APIKey{}
+		if err := rows.Scan(&k.ID, &k.Name, &k.CreatedBy, &k.Created, &k.LastUsed); err != nil {
+			log.Printf("postgres: error unmarshaling api key query result: %s", err.Error())
+			continue
+		}
+		res = append(res, &k)
+	}
+
+	return res, rows.Close()
+}
+
+func (ks *apiKeyService) RevokeKey(id int64) error {
+	_, err := db.Exec(revokeAPIKey, id)
+	return err
+}
+
+// CheckKey returns the key the token belongs to, or nil for unknown and revoked tokens
+func (ks *apiKeyService) CheckKey(token string) (*telecollector.APIKey, error) {
+	k := telecollector.APIKey{}
+	err := db.QueryRow(touchAPIKey, hashAPIToken(token)).Scan(&k.ID, &k.Name, &k.CreatedBy, &k.Created, &k.LastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
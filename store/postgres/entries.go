@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kalambet/telecollector/telecollector"
+	"github.com/lib/pq"
+)
+
+const (
+	entryColumns = `
+select m.message_id, m.chat_id, m.author_id, m.date, m.updated, m.text, m.entities, m.tags, m.note, m.parts,
+    coalesce(c.name, ''), trim(coalesce(a.first, '') || ' ' || coalesce(a.last, ''))`
+
+	entrySource = `
+    from messages m
+    left join chats c on c.chat_id = m.chat_id
+    left join authors a on a.author_id = m.author_id`
+
+	selectEntries = entryColumns + entrySource
+
+	// Entries of moderated chats are saved before review, they are
+	// not shown anywhere until admins approve them
+	notPending = `not exists (select from reviews r 
+        where r.message_id = m.message_id and r.chat_id = m.chat_id and r.status = 'pending')`
+
+	queryEntry = selectEntries + `
+    where m.message_id = $1 and m.chat_id = $2 and m.deleted_at is null;`
+
+	queryTagCounts = `
+select lower(t), count(*) from messages m, unnest(m.tags) t 
+    where m.deleted_at is null and ` + notPending + `
+    group by 1 order by 2 desc, 1;`
+
+	queryChats = `
+select c.chat_id, coalesce(c.name, ''), count(m.message_id) from chats c
+    left join messages m on m.chat_id = c.chat_id and m.deleted_at is null and ` + notPending + `
+    group by c.chat_id order by c.chat_id;`
+
+	queryAuthors = `
+select a.author_id, trim(a.first || ' ' || coalesce(a.last, '')), coalesce(a.username, ''), count(m.message_id) 
+    from authors a
+    left join messages m on m.author_id = a.author_id and m.deleted_at is null and ` + notPending + `
+    group by a.author_id order by a.author_id;`
+
+	headlineOptions = "StartSel=" + telecollector.HighlightStart + ", StopSel=" + telecollector.HighlightStop +
+		", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \""
+)
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEntry reads entry columns, extra destinations follow them in the row
+func scanEntry(row scanner, extra ...interface{}) (*telecollector.Entry, error) {
+	e := telecollector.Entry{}
+	var entities []byte
+	dest := []interface{}{&e.MessageID, &e.ChatID, &e.AuthorID, &e.Date, &e.Updated, &e.Text, &entities,
+		pq.Array(&e.Tags), &e.Note, pq.Array(&e.Parts), &e.ChatName, &e.AuthorName}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(entities, &e.Entities)
+	if err != nil {
+		log.Printf("postgres: error unmarshaling message entities: %s", err.Error())
+	}
+
+	return &e, nil
+}
+
+func (s *messagesService) FindEntry(msgID int64, chatID int64) (*telecollector.Entry, error) {
+	e, err := scanEntry(db.QueryRow(queryEntry, msgID, chatID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return e, err
+}
+
+// Search looks for entries matching full-text query and filters,
+// best ranked come first when there is a query, the most recent otherwise
+func (s *messagesService) Search(q *telecollector.SearchQuery) ([]*telecollector.Entry, error) {
+	res := make([]*telecollector.Entry, 0)
+	err := s.Walk(q, func(e *telecollector.Entry) error {
+		res = append(res, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Walk streams entries found by the query to fn one by one,
+// zero limit walks through all of them
+func (s *messagesService) Walk(q *telecollector.SearchQuery, fn func(e *telecollector.Entry) error) error {
+	query, args := buildSearch(q)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var hl string
+		e, err := scanEntry(rows, &hl)
+		if err != nil {
+			log.Printf("postgres: error unmarshaling entry query result: %s", err.Error())
+			continue
+		}
+		e.Highlight = hl
+
+		err = fn(e)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+	}
+
+	return rows.Close()
+}
+
+func buildSearch(q *telecollector.SearchQuery) (string, []interface{}) {
+	conds := []string{"m.deleted_at is null", notPending}
+	args := make([]interface{}, 0)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.ChatIDs != nil {
+		conds = append(conds, "m.chat_id = any("+arg(pq.Array(q.ChatIDs))+")")
+	}
+
+	for _, t := range q.Tags {
+		conds = append(conds, "exists (select from unnest(m.tags) t where lower(t) = "+arg(strings.ToLower(t))+")")
+	}
+
+	if q.AuthorID != 0 {
+		conds = append(conds, "m.author_id = "+arg(q.AuthorID))
+	}
+
+	if q.Since != 0 {
+		conds = append(conds, "m.date >= "+arg(q.Since))
+	}
+
+	if q.Until != 0 {
+		conds = append(conds, "m.date <= "+arg(q.Until))
+	}
+
+	if q.UpdatedSince != 0 {
+		conds = append(conds, "m.updated >= "+arg(q.UpdatedSince))
+	}
+
+	highlight, order := "''", "m.date desc"
+	if q.Chronological {
+		order = "m.date, m.message_id"
+	}
+	if text := strings.TrimSpace(q.Text); len(text) != 0 {
+		lang := arg(searchLanguage) + "::regconfig"
+		tsq := fmt.Sprintf("websearch_to_tsquery(%s, %s)", lang, arg(text))
+		conds = append(conds, "m.search @@ "+tsq)
+		highlight = fmt.Sprintf("ts_headline(%s, m.text, %s, %s)", lang, tsq, arg(headlineOptions))
+		order = fmt.Sprintf("ts_rank(m.search, %s) desc, m.date desc", tsq)
+	}
+
+	query := fmt.Sprintf("%s, %s %s where %s order by %s",
+		entryColumns, highlight, entrySource, strings.Join(conds, " and "), order)
+	if q.Limit > 0 {
+		query += " limit " + arg(q.Limit)
+	}
+	if q.Offset > 0 {
+		query += " offset " + arg(q.Offset)
+	}
+
+	return query + ";", args
+}
+
+// EntryIDs runs the search query for ids only, so the whole collection
+// can be listed cheaply
+func (s *messagesService) EntryIDs(q *telecollector.SearchQuery) ([]*telecollector.Entry, error) {
+	query, args := buildSearch(q)
+	rows, err := db.Query("select message_id, chat_id from ("+strings.TrimSuffix(query, ";")+") e;", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*telecollector.Entry, 0)
+	for rows.Next() {
+		e := telecollector.Entry{}
+		if err := rows.Scan(&e.MessageID, &e.ChatID); err != nil {
+			log.Printf("postgres: error unmarshaling entry id query result: %s", err.Error())
+			continue
+		}
+		res = append(res, &e)
+	}
+
+	return res, rows.Close()
+}
+
+func (s *messagesService) Tags() ([]*telecollector.TagCount, error) {
+	rows, err := db.Query(queryTagCounts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*telecollector.TagCount, 0)
+	for rows.Next() {
+		t := telecollector.TagCount{}
+		if err := rows.Scan(&t.Tag, &t.Entries); err != nil {
+			log.Printf("postgres: error unmarshaling tag query result: %s", err.Error())
+			continue
+		}
+		res = append(res, &t)
+	}
+
+	return res, rows.Close()
+}
+
+func (s *messagesService) Chats() ([]*telecollector.ChatInfo, error) {
+	rows, err := db.Query(queryChats)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*telecollector.ChatInfo, 0)
+	for rows.Next() {
+		c := telecollector.ChatInfo{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Entries); err != nil {
+			log.Printf("postgres: error unmarshaling chat query result: %s", err.Error())
+			continue
+		}
+		res = append(res, &c)
+	}
+
+	return res, rows.Close()
+}
+
+func (s *messagesService) Authors() ([]*telecollector.AuthorInfo, error) {
+	rows, err := db.Query(queryAuthors)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*telecollector.AuthorInfo, 0)
+	for rows.Next() {
+		a := telecollector.AuthorInfo{}
+		if err := rows.Scan(&a.ID, &a.Name, &a.UserName, &a.Entries); err != nil {
+			log.Printf("postgres: error unmarshaling author query result: %s", err.Error())
+			continue
+		}
+		res = append(res, &a)
+	}
+
+	return res, rows.Close()
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	createJobs = `
+create table jobs(
+    name text primary key,
+    last_run timestamp with time zone not null,
+    last_error text not null default '',
+    runs bigint not null default 0
+);`
+
+	queryJobLastRun = `select last_run from jobs where name = $1;`
+
+	upsertJobRun = `
+insert into jobs (name, last_run, last_error, runs) values ($1, $2, $3, 1)
+    on conflict (name) do update set last_run = $2, last_error = $3, runs = jobs.runs + 1;`
+
+	// Advisory locks are taken by the hash of job name within the namespace of jobs
+	tryLockJob = `select pg_try_advisory_lock(hashtext('telecollector_jobs'), hashtext($1));`
+	unlockJob  = `select pg_advisory_unlock(hashtext('telecollector_jobs'), hashtext($1));`
+)
+
+// jobService holds the connection of every locked job,
+// advisory locks belong to the session which has taken them
+type jobService struct {
+	mu    sync.Mutex
+	conns map[string]*sql.Conn
+}
+
+func NewJobService() (telecollector.JobService, error) {
+	err := gracefulCreateTable("jobs", createJobs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jobService{conns: make(map[string]*sql.Conn)}, nil
+}
+
+func (js *jobService) LastRun(name string) (time.Time, error) {
+	var last time.Time
+	err := db.QueryRow(queryJobLastRun, name).Scan(&last)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return last, err
+}
+
+func (js *jobService) Lock(name string) (bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if _, ok := js.conns[name]; ok {
+		return false, nil
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(context.Background(), tryLockJob, name).Scan(&locked)
+	if err != nil || !locked {
+		_ = conn.Close()
+		return false, err
+	}
+
+	js.conns[name] = conn
+	return true, nil
+}
+
+func (js *jobService) Unlock(name string) error {
+	js.mu.Lock()
+	conn, ok := js.conns[name]
+	delete(js.conns, name)
+	js.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	defer conn.Close()
+
+	var unlocked bool
+	return conn.QueryRowContext(context.Background(), unlockJob, name).Scan(&unlocked)
+}
+
+func (js *jobService) Finish(name string, at time.Time, jobErr error) error {
+	msg := ""
+	if jobErr != nil {
+		msg = jobErr.Error()
+	}
+
+	_, err := db.Exec(upsertJobRun, name, at, msg)
+	return err
+}
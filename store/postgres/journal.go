@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	createUpdateJournal = `
+create table update_journal(
+    id bigserial primary key,
+    received timestamptz not null default now(),
+    body jsonb not null
+);`
+
+	queryJournalReceivedType = `
+select data_type from information_schema.columns 
+    where table_schema = 'public' and table_name = 'update_journal' and column_name = 'received';`
+
+	// Journals created before kept UTC time without zone
+	alterJournalReceived = `
+alter table update_journal 
+    alter column received type timestamptz using received at time zone 'utc', 
+    alter column received set default now();`
+
+	insertJournalUpdate = `insert into update_journal (body) values ($1);`
+
+	countExpiredUpdates = `select count(*) from update_journal where received < $1;`
+
+	deleteExpiredUpdates = `delete from update_journal where received < $1;`
+
+	// Update belongs to the user when any object of it has their id: sender, reactor or private chat
+	userUpdateFilter = `jsonb_path_exists(body, 'strict $.** ? (@.id == $id)', jsonb_build_object('id', $1::bigint))`
+
+	queryUserUpdates = `select body from update_journal where ` + userUpdateFilter + ` order by id;`
+
+	deleteUserUpdates = `delete from update_journal where ` + userUpdateFilter + `;`
+
+	queryJournalUpdates = `
+select received, body from update_journal 
+    where received >= $1 order by id;`
+)
+
+// updateJournal keeps the database it was opened in,
+// so updates can be replayed from it into another store
+type updateJournal struct {
+	db *sql.DB
+}
+
+func NewUpdateJournal() (telecollector.UpdateJournal, error) {
+	err := gracefulCreateTable("update_journal", createUpdateJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	var received string
+	err = db.QueryRow(queryJournalReceivedType).Scan(&received)
+	if err != nil {
+		return nil, err
+	}
+	if received != "timestamp with time zone" {
+		err = migrate(alterJournalReceived)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &updateJournal{db: db}, nil
+}
+
+func (j *updateJournal) Record(raw []byte) error {
+	_, err := j.db.Exec(insertJournalUpdate, string(raw))
+	return err
+}
+
+func (j *updateJournal) Replay(since time.Time, fn func(at time.Time, raw []byte) error) error {
+	rows, err := j.db.Query(queryJournalUpdates, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var at time.Time
+		var raw []byte
+		err = rows.Scan(&at, &raw)
+		if err != nil {
+			return err
+		}
+
+		err = fn(at, raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (j *updateJournal) Expired(before time.Time) (int64, error) {
+	var n int64
+	err := j.db.QueryRow(countExpiredUpdates, before).Scan(&n)
+	return n, err
+}
+
+func (j *updateJournal) Truncate(before time.Time) (int64, error) {
+	res, err := j.db.Exec(deleteExpiredUpdates, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (j *updateJournal) UserUpdates(userID int64) ([]json.RawMessage, error) {
+	return queryRaw(j.db, queryUserUpdates, userID)
+}
+
+func (j *updateJournal) EraseUser(userID int64) (int64, error) {
+	res, err := j.db.Exec(deleteUserUpdates, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -2,8 +2,13 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kalambet/telecollector/telegram"
 
@@ -21,9 +26,47 @@ create table messages(
     date bigint, 
     text text not null, 
     tags text[] not null default '{}', 
+    entities jsonb not null default '[]',
+    note text not null default '',
+    note_author_id bigint not null default 0,
+    deleted_at timestamp,
+    updated bigint not null default 0,
+    parts text[] not null default '{}',
     primary key(message_id, chat_id)
 );`
 
+	// Text of entries saved before is their only part, appended ones can not be told apart
+	alterMessageParts = `
+alter table messages add column if not exists parts text[] not null default '{}';
+update messages set parts = array[text] where cardinality(parts) = 0 and text <> '';`
+
+	// Entries saved before are considered updated when they were posted
+	alterMessageUpdated = `
+alter table messages add column if not exists updated bigint not null default 0;
+update messages set updated = date where updated = 0;`
+
+	alterMessageDeleted = `alter table messages add column if not exists deleted_at timestamp;`
+
+	alterMessageNote = `alter table messages add column if not exists note text not null default '';`
+
+	alterMessageNoteAuthor = `alter table messages add column if not exists note_author_id bigint not null default 0;`
+
+	alterMessageEntities = `alter table messages add column if not exists entities jsonb not null default '[]';`
+
+	// Search vector is generated from the text and the note with the configured
+	// language, so changing SEARCH_LANGUAGE rebuilds the column and its index
+	alterMessageSearch = `
+alter table messages drop column if exists search;
+alter table messages add column search tsvector 
+    generated always as (to_tsvector('%[1]s'::regconfig, text || ' ' || note)) stored;
+create index messages_search_idx on messages using gin(search);`
+
+	querySearchLanguage = `select exists (select from pg_ts_config where cfgname = $1);`
+
+	querySearchExpression = `
+select coalesce(generation_expression, '') from information_schema.columns 
+    where table_schema = 'public' and table_name = 'messages' and column_name = 'search';`
+
 	createAuthors = `
 create table authors(
     author_id bigint primary key, 
@@ -43,12 +86,32 @@ create table chats(
 create table broadcasts(
     message_id bigint,
 	chat_id bigint,
+    channel_id bigint not null default 0,
     broadcast_id bigint,
-	primary key(message_id, chat_id)
+    broadcast_ids bigint[] not null default '{}',
+    authors bigint[] not null default '{}',
+    attributed boolean not null default false,
+	primary key(message_id, chat_id, channel_id)
 );`
 
+	alterBroadcastChannel = `
+alter table broadcasts add column channel_id bigint not null default 0;
+alter table broadcasts drop constraint if exists broadcasts_pkey;
+alter table broadcasts add primary key (message_id, chat_id, channel_id);`
+
+	updateBroadcastChannel = `update broadcasts set channel_id = $1 where channel_id = 0;`
+
+	alterBroadcastIDs = `
+alter table broadcasts add column if not exists broadcast_ids bigint[] not null default '{}';
+update broadcasts set broadcast_ids = array[broadcast_id] where cardinality(broadcast_ids) = 0;`
+
+	alterBroadcastAuthors = `alter table broadcasts add column if not exists authors bigint[] not null default '{}';`
+
+	alterBroadcastAttributed = `alter table broadcasts add column if not exists attributed boolean not null default false;`
+
 	queryMessagesExistence = `
-select exists (select from messages where message_id = $1 and chat_id = $2 and author_id = $3 and date = $4);`
+select exists (select from messages 
+    where message_id = $1 and chat_id = $2 and author_id = $3 and date = $4 and deleted_at is null);`
 
 	insertChat = `
 insert into 
@@ -64,26 +127,40 @@ insert into
 
 	insertMessage = `
 insert into 
-    messages (update_id, message_id, chat_id, author_id, date, text, tags) 
-    values ($1, $2, $3, $4, $5, $6, $7) 
+    messages (update_id, message_id, chat_id, author_id, date, text, tags, entities, note, updated, parts, note_author_id) 
+    values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, array[$11::text], $12) 
     on conflict (message_id, chat_id) 
-        do update set date = $5, text = $6, tags = $7 returning text;`
+        do update set date = $5, text = $6, tags = $7, entities = $8, updated = $10, parts = array[$11::text] 
+        where messages.deleted_at is null 
+        returning text, entities;`
 
 	appendMessage = `
 insert into 
-    messages (update_id, message_id, chat_id, author_id, date, text, tags) 
-    values ($1, $2, $3, $4, $5, $6, $7) 
+    messages (update_id, message_id, chat_id, author_id, date, text, tags, entities, note, updated, parts, note_author_id) 
+    values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, array[$11::text], $12) 
     on conflict (message_id, chat_id) 
-        do update set date = $5, text = messages.text || ' ➜ ' || $6 returning text;`
+        do update set date = $5, text = $6, entities = $8, updated = $10, parts = messages.parts || $11::text 
+        where messages.deleted_at is null 
+        returning text, entities;`
+
+	queryMessageCollected = `
+select exists (select from messages where message_id = $1 and chat_id = $2 and deleted_at is null);`
+
+	forgetMessage = `update messages set deleted_at = now() where message_id = $1 and chat_id = $2;`
+
+	deleteBroadcasts = `delete from broadcasts where message_id = $1 and chat_id = $2;`
+
+	queryMessageContent = `select text, entities from messages where message_id = $1 and chat_id = $2 for update;`
 
 	insertBroadcast = `
 insert into
-	broadcasts (message_id, chat_id, broadcast_id)
-	values ($1, $2, $3)
-	on conflict (message_id, chat_id)
-		do update set broadcast_id = $3;`
+	broadcasts (message_id, chat_id, channel_id, broadcast_id, broadcast_ids, authors, attributed)
+	values ($1, $2, $3, $4, $5, $6, $7)
+	on conflict (message_id, chat_id, channel_id)
+		do update set broadcast_id = $4, broadcast_ids = $5, authors = $6, attributed = $7;`
 
-	queryBroadcast = `select broadcast_id from broadcasts where message_id = $1 and chat_id = $2;`
+	queryBroadcasts = `
+select channel_id, broadcast_ids, authors, attributed from broadcasts where message_id = $1 and chat_id = $2;`
 )
 
 type messagesService struct{}
@@ -95,6 +172,41 @@ func NewMessagesService() (*messagesService, error) {
 		return nil, err
 	}
 
+	err = migrate(alterMessageEntities)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterMessageNote)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterMessageNoteAuthor)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterMessageDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterMessageUpdated)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterMessageParts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrateSearch()
+	if err != nil {
+		return nil, err
+	}
+
 	err = gracefulCreateTable("authors", createAuthors)
 	if err != nil {
 		return nil, err
@@ -110,59 +222,138 @@ func NewMessagesService() (*messagesService, error) {
 		return nil, err
 	}
 
+	err = migrate(alterBroadcastIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterBroadcastAuthors)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterBroadcastAttributed)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrateBroadcastChannel()
+	if err != nil {
+		return nil, err
+	}
+
 	return &messagesService{}, nil
 }
 
-func (s *messagesService) Save(ctx *telecollector.MessageContext) (string, error) {
+func (s *messagesService) Save(ctx *telecollector.MessageContext) (*telegram.Text, error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	_, err = tx.Exec(insertChat, ctx.Message.Chat.ID, "Telegram", ctx.Message.Chat.Title)
 
 	if err != nil {
-		return "", rollback(tx, err)
+		return nil, rollback(tx, err)
 	}
 
-	_, err = tx.Exec(insertAuthor, ctx.Message.From.ID, ctx.Message.From.FirstName, ctx.Message.From.LastName, ctx.Message.From.UserName)
+	author := ctx.Message.Author()
+	_, err = tx.Exec(insertAuthor, author.ID, author.FirstName, author.LastName, author.UserName)
 
 	if err != nil {
-		return "", rollback(tx, err)
+		return nil, rollback(tx, err)
 	}
 
 	var query string
 	var msgID int64
+	content := ctx.Message.Content()
+	part := content.Text
 	if ctx.Action == telecollector.ActionAppend {
 		query = appendMessage
 		msgID = ctx.ConnectedMessageID
+
+		// Entities of the appended part have to be shifted behind the existing text
+		prev, err := loadContent(tx, msgID, ctx.Message.Chat.ID)
+		if err != nil {
+			return nil, rollback(tx, err)
+		}
+		if prev != nil {
+			content = prev.Append(telegram.JoinSeparator, content)
+		}
 	} else {
 		query = insertMessage
 		msgID = ctx.Message.ID
 	}
 
+	entities, err := json.Marshal(content.Entities)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	var note string
+	var noteAuthorID int64
+	if ctx.Note != nil {
+		note, noteAuthorID = ctx.Note.Text, ctx.NoteAuthorID
+	}
+
+	// Imported messages come without update, so there is nothing to keep unique
+	updateID := sql.NullInt64{Int64: ctx.UpdateID, Valid: ctx.UpdateID != 0}
 	rows, err := tx.Query(query,
-		ctx.UpdateID, msgID, ctx.Message.Chat.ID, ctx.Message.Author().ID,
-		ctx.Message.Date, ctx.Message.Text2Save(), pq.Array(ctx.Message.Tags()))
+		updateID, msgID, ctx.Message.Chat.ID, author.ID,
+		ctx.Message.Date, content.Text, pq.Array(ctx.Message.Tags()), entities, note, time.Now().Unix(), part, noteAuthorID)
 
 	if err != nil {
-		return "", rollback(tx, err)
+		return nil, rollback(tx, err)
 	}
 
-	var text string
+	res, err := scanContent(rows)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+	// Forgotten entry keeps the row, conflict update skips it and returns nothing
+	if res == nil {
+		return nil, rollback(tx, telecollector.ErrEntryForgotten)
+	}
+
+	return res, tx.Commit()
+}
+
+func loadContent(tx *sql.Tx, msgID int64, chatID int64) (*telegram.Text, error) {
+	rows, err := tx.Query(queryMessageContent, msgID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanContent(rows)
+}
+
+// scanContent reads `text, entities` pair from the first row and closes rows.
+// It returns nil when there are no rows.
+func scanContent(rows *sql.Rows) (*telegram.Text, error) {
+	var res *telegram.Text
 	if rows.Next() {
-		err = rows.Scan(&text)
+		var text string
+		var raw []byte
+		err := rows.Scan(&text, &raw)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		var entities []*telegram.MessageEntity
+		err = json.Unmarshal(raw, &entities)
 		if err != nil {
-			return "", err
+			log.Printf("postgres: error unmarshaling message entities: %s", err.Error())
 		}
+		res = telegram.EntitiesText(text, entities)
 	}
 
-	err = rows.Close()
+	err := rows.Close()
 	if err != nil {
 		log.Printf("postgres: error closing query rows: %s", err.Error())
 	}
 
-	return text, tx.Commit()
+	return res, nil
 }
 
 func (s *messagesService) CheckConnected(msg *telegram.Message) (bool, error) {
@@ -190,38 +381,116 @@ func (s *messagesService) CheckConnected(msg *telegram.Message) (bool, error) {
 	return false, nil
 }
 
-func (s *messagesService) LogBroadcast(msg *telegram.Message, bcID int64) error {
-	_, err := db.Exec(insertBroadcast, msg.ID, msg.Chat.ID, bcID)
+// migrateBroadcastChannel keys broadcasts by destination channel,
+// broadcasts made before routing are attributed to the default channel
+func migrateBroadcastChannel() error {
+	exists, err := columnExists("broadcasts", "channel_id")
+	if err != nil || exists {
+		return err
+	}
+
+	err = migrate(alterBroadcastChannel)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	channel, err := strconv.ParseInt(os.Getenv("TG_CHANNEL"), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	_, err = db.Exec(updateBroadcastChannel, channel)
+	return err
 }
 
-func (s *messagesService) FindBroadcast(msgID int64, chatID int64) (int64, error) {
-	rows, err := db.Query(queryBroadcast, msgID, chatID)
+// migrateSearch (re)creates full-text search column when it's missing
+// or was generated with another language configuration
+func migrateSearch() error {
+	var known bool
+	err := db.QueryRow(querySearchLanguage, searchLanguage).Scan(&known)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return fmt.Errorf("postgres: unknown text search configuration %q", searchLanguage)
+	}
 
+	var expr string
+	err = db.QueryRow(querySearchExpression).Scan(&expr)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if strings.Contains(expr, "'"+searchLanguage+"'::regconfig") {
+		return nil
+	}
+
+	return migrate(fmt.Sprintf(alterMessageSearch, searchLanguage))
+}
+
+func (s *messagesService) IsCollected(msgID int64, chatID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRow(queryMessageCollected, msgID, chatID).Scan(&exists)
+	return exists, err
+}
+
+// Forget soft-deletes the entry and drops its broadcasts log,
+// broadcasts themselves are expected to be deleted from channels already
+func (s *messagesService) Forget(msgID int64, chatID int64) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	if rows.Next() {
-		var bcID int64
-		err = rows.Scan(&bcID)
-		if err != nil {
-			return 0, nil
-		}
+	_, err = tx.Exec(forgetMessage, msgID, chatID)
+	if err != nil {
+		return rollback(tx, err)
+	}
 
-		return bcID, nil
+	_, err = tx.Exec(deleteBroadcasts, msgID, chatID)
+	if err != nil {
+		return rollback(tx, err)
 	}
 
-	err = rows.Close()
+	return tx.Commit()
+}
+
+func (s *messagesService) LogBroadcast(msg *telegram.Message, bc *telecollector.Broadcast) error {
+	if len(bc.MessageIDs) == 0 {
+		return nil
+	}
+
+	authors := bc.Authors
+	if authors == nil {
+		authors = []int64{}
+	}
+	_, err := db.Exec(insertBroadcast, msg.ID, msg.Chat.ID, bc.ChannelID, bc.MessageIDs[0],
+		pq.Array(bc.MessageIDs), pq.Array(authors), bc.Attributed)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *messagesService) FindBroadcasts(msgID int64, chatID int64) ([]*telecollector.Broadcast, error) {
+	rows, err := db.Query(queryBroadcasts, msgID, chatID)
+
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	res := make([]*telecollector.Broadcast, 0)
+	for rows.Next() {
+		bc := telecollector.Broadcast{}
+		err = rows.Scan(&bc.ChannelID, pq.Array(&bc.MessageIDs), pq.Array(&bc.Authors), &bc.Attributed)
+		if err != nil {
+			log.Printf("postgres: error unmarshaling broadcast query result: %s", err.Error())
+			continue
+		}
+		res = append(res, &bc)
 	}
 
-	return 0, nil
+	return res, rows.Close()
 }
 
 func rollback(tx *sql.Tx, err error) error {
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	createReviews = `
+create table reviews(
+    message_id bigint,
+    chat_id bigint,
+    review_message_id bigint not null,
+    status text not null,
+    raw jsonb not null,
+    note jsonb,
+    note_author_id bigint not null default 0,
+    decided_by bigint,
+    decided_at timestamp,
+    primary key(message_id, chat_id)
+);`
+
+	alterReviewNoteAuthor = `alter table reviews add column if not exists note_author_id bigint not null default 0;`
+
+	insertReview = `
+insert into 
+    reviews (message_id, chat_id, review_message_id, status, raw, note, note_author_id) 
+    values ($1, $2, $3, $4, $5, $6, $7) 
+    on conflict (message_id, chat_id) 
+        do update set review_message_id = $3, status = $4, raw = $5, note = $6, note_author_id = $7, 
+            decided_by = null, decided_at = null;`
+
+	queryReview = `
+select message_id, chat_id, review_message_id, status, raw, note, note_author_id from reviews 
+    where message_id = $1 and chat_id = $2;`
+
+	updateReview = `
+update reviews set status = $3, decided_by = $4, decided_at = now() 
+    where message_id = $1 and chat_id = $2 and status = 'pending';`
+
+	// Approved entry shows up for the first time, so incremental readers
+	// like feeds and vault sync should see it as updated
+	touchApproved = `
+update messages set updated = extract(epoch from now())::bigint 
+    where message_id = $1 and chat_id = $2;`
+)
+
+type moderationService struct{}
+
+func NewModerationService() (telecollector.ModerationService, error) {
+	err := gracefulCreateTable("reviews", createReviews)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterReviewNoteAuthor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &moderationService{}, nil
+}
+
+func (ms *moderationService) Enqueue(ctx *telecollector.MessageContext, reviewMsgID int64) error {
+	raw, err := json.Marshal(ctx.Message)
+	if err != nil {
+		return err
+	}
+
+	var note []byte
+	if ctx.Note != nil {
+		note, err = json.Marshal(ctx.Note)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(insertReview, ctx.Message.ID, ctx.Message.Chat.ID, reviewMsgID,
+		telecollector.ReviewPending, raw, note, ctx.NoteAuthorID)
+	return err
+}
+
+func (ms *moderationService) FindReview(msgID int64, chatID int64) (*telecollector.Review, error) {
+	rv := telecollector.Review{}
+	var raw, note []byte
+	err := db.QueryRow(queryReview, msgID, chatID).Scan(
+		&rv.MessageID, &rv.ChatID, &rv.ReviewMessageID, &rv.Status, &raw, &note, &rv.NoteAuthorID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rv.Message = &telegram.Message{}
+	err = json.Unmarshal(raw, rv.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(note) != 0 {
+		rv.Note = &telegram.Text{}
+		err = json.Unmarshal(note, rv.Note)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &rv, nil
+}
+
+// Decide settles pending review, it fails with telecollector.ErrReviewDecided
+// when the review was already decided by someone else
+func (ms *moderationService) Decide(msgID int64, chatID int64, status string, adminID int64) error {
+	res, err := db.Exec(updateReview, msgID, chatID, status, adminID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return telecollector.ErrReviewDecided
+	}
+
+	if status == telecollector.ReviewApproved {
+		_, err = db.Exec(touchApproved, msgID, chatID)
+		return err
+	}
+
+	return nil
+}
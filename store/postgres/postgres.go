@@ -4,13 +4,26 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"strconv"
 
 	_ "github.com/lib/pq"
 )
 
 var db *sql.DB
 
-const queryTableExistence = `select exists (select from pg_tables where schemaname = 'public' and tablename = $1);`
+// unicodeNorm enables Unicode folding of tags for every collection decision
+var unicodeNorm bool
+
+// searchLanguage is text search configuration used to index messages
+var searchLanguage = "simple"
+
+const (
+	queryTableExistence = `select exists (select from pg_tables where schemaname = 'public' and tablename = $1);`
+
+	queryColumnExistence = `
+select exists (select from information_schema.columns 
+    where table_schema = 'public' and table_name = $1 and column_name = $2);`
+)
 
 func init() {
 	var err error
@@ -18,6 +31,27 @@ func init() {
 	if err != nil {
 		log.Fatalf("postgres: startup problem: %s", err.Error())
 	}
+
+	unicodeNorm, err = strconv.ParseBool(os.Getenv("TRIGGER_UNICODE_NORMALIZATION"))
+	if err != nil {
+		unicodeNorm = false
+	}
+
+	if lang := os.Getenv("SEARCH_LANGUAGE"); len(lang) != 0 {
+		searchLanguage = lang
+	}
+}
+
+// Connect points services created afterwards to the database at the url
+// instead of DATABASE_URL, services created before keep their connection
+func Connect(url string) error {
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		return err
+	}
+
+	db = conn
+	return nil
 }
 
 func Shutdown() error {
@@ -57,3 +91,14 @@ func gracefulCreateTable(table string, query string) error {
 
 	return nil
 }
+
+func migrate(query string) error {
+	_, err := db.Exec(query)
+	return err
+}
+
+func columnExists(table string, column string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(queryColumnExistence, table, column).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,282 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	defaultReactionWindow = 48 * time.Hour
+
+	createReactionTriggers = `
+create table reaction_triggers(
+    chat_id bigint,
+    emoji text,
+    threshold int not null default 1,
+    primary key(chat_id, emoji)
+);`
+
+	createRecentMessages = `
+create table recent_messages(
+    message_id bigint,
+    chat_id bigint,
+    date bigint not null,
+    raw jsonb not null,
+    primary key(message_id, chat_id)
+);`
+
+	createReactions = `
+create table reactions(
+    message_id bigint,
+    chat_id bigint,
+    reactor_id bigint,
+    emoji text,
+    date bigint not null,
+    primary key(message_id, chat_id, reactor_id, emoji)
+);`
+
+	// Buffers are purged by date on schedule
+	createReactionDateIndexes = `
+create index if not exists recent_messages_date_idx on recent_messages(date);
+create index if not exists reactions_date_idx on reactions(date);`
+
+	queryReactionTriggers = `select chat_id, emoji, threshold from reaction_triggers;`
+
+	insertReactionTrigger = `
+insert into 
+    reaction_triggers (chat_id, emoji, threshold) 
+    values ($1, $2, $3) 
+    on conflict (chat_id, emoji) 
+        do update set threshold = $3;`
+
+	deleteReactionTrigger = `delete from reaction_triggers where chat_id = $1 and emoji = $2;`
+
+	insertRecentMessage = `
+insert into 
+    recent_messages (message_id, chat_id, date, raw) 
+    values ($1, $2, $3, $4) 
+    on conflict (message_id, chat_id) 
+        do update set raw = $4;`
+
+	queryRecentMessage = `select raw from recent_messages where message_id = $1 and chat_id = $2;`
+
+	purgeRecentMessages = `delete from recent_messages where date < $1;`
+
+	purgeReactions = `delete from reactions where date < $1;`
+
+	insertReaction = `
+insert into 
+    reactions (message_id, chat_id, reactor_id, emoji, date) 
+    values ($1, $2, $3, $4, $5) 
+    on conflict do nothing;`
+
+	deleteReaction = `delete from reactions where message_id = $1 and chat_id = $2 and reactor_id = $3 and emoji = $4;`
+
+	queryReactionCounts = `
+select emoji, count(*) from reactions 
+    where message_id = $1 and chat_id = $2 
+    group by emoji;`
+)
+
+type reactionsService struct {
+	mu       sync.RWMutex
+	triggers map[int64][]*telecollector.ReactionTrigger
+	window   time.Duration
+}
+
+func NewReactionService() (telecollector.ReactionService, error) {
+	err := gracefulCreateTable("reaction_triggers", createReactionTriggers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gracefulCreateTable("recent_messages", createRecentMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gracefulCreateTable("reactions", createReactions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(createReactionDateIndexes)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &reactionsService{window: defaultReactionWindow}
+	hours, err := strconv.Atoi(os.Getenv("REACTION_WINDOW_HOURS"))
+	if err == nil && hours > 0 {
+		rs.window = time.Duration(hours) * time.Hour
+	}
+
+	err = rs.loadTriggers()
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+func (rs *reactionsService) loadTriggers() error {
+	rows, err := db.Query(queryReactionTriggers)
+	if err != nil {
+		return err
+	}
+
+	triggers := make(map[int64][]*telecollector.ReactionTrigger)
+	for rows.Next() {
+		t := telecollector.ReactionTrigger{}
+		if err := rows.Scan(&t.ChatID, &t.Emoji, &t.Threshold); err != nil {
+			log.Printf("postgres: error unmarshaling reaction trigger query result: %s", err.Error())
+			continue
+		}
+		triggers[t.ChatID] = append(triggers[t.ChatID], &t)
+	}
+
+	rs.mu.Lock()
+	rs.triggers = triggers
+	rs.mu.Unlock()
+
+	return rows.Close()
+}
+
+func (rs *reactionsService) ReactionTriggers(chatID int64) []*telecollector.ReactionTrigger {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if t := rs.triggers[chatID]; len(t) != 0 {
+		return append([]*telecollector.ReactionTrigger{}, t...)
+	}
+
+	return append([]*telecollector.ReactionTrigger{}, rs.triggers[telecollector.TriggerScopeGlobal]...)
+}
+
+func (rs *reactionsService) AddReactionTrigger(t *telecollector.ReactionTrigger) error {
+	if t.Threshold < 1 {
+		t.Threshold = 1
+	}
+
+	_, err := db.Exec(insertReactionTrigger, t.ChatID, t.Emoji, t.Threshold)
+	if err != nil {
+		return err
+	}
+
+	return rs.loadTriggers()
+}
+
+func (rs *reactionsService) RemoveReactionTrigger(chatID int64, emoji string) error {
+	_, err := db.Exec(deleteReactionTrigger, chatID, emoji)
+	if err != nil {
+		return err
+	}
+
+	return rs.loadTriggers()
+}
+
+// Remember keeps the message for the reaction window
+func (rs *reactionsService) Remember(msg *telegram.Message) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(insertRecentMessage, msg.ID, msg.Chat.ID, msg.Date, raw)
+	return err
+}
+
+// Purge drops messages and reactions older than the reaction window
+func (rs *reactionsService) Purge() (int64, error) {
+	edge := time.Now().Add(-rs.window).Unix()
+	var total int64
+	for _, q := range []string{purgeRecentMessages, purgeReactions} {
+		res, err := db.Exec(q, edge)
+		if err != nil {
+			return total, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+func (rs *reactionsService) Recall(chatID int64, msgID int64) (*telegram.Message, error) {
+	var raw []byte
+	err := db.QueryRow(queryRecentMessage, msgID, chatID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var msg telegram.Message
+	err = json.Unmarshal(raw, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// React applies the change of user's reactions and returns
+// the current number of reactors per emoji
+func (rs *reactionsService) React(r *telegram.MessageReactionUpdated) (map[string]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	reactor := r.ReactorID()
+	for _, old := range r.OldReaction {
+		_, err = tx.Exec(deleteReaction, r.MessageID, r.Chat.ID, reactor, old.Key())
+		if err != nil {
+			return nil, rollback(tx, err)
+		}
+	}
+
+	for _, nr := range r.NewReaction {
+		_, err = tx.Exec(insertReaction, r.MessageID, r.Chat.ID, reactor, nr.Key(), r.Date)
+		if err != nil {
+			return nil, rollback(tx, err)
+		}
+	}
+
+	rows, err := tx.Query(queryReactionCounts, r.MessageID, r.Chat.ID)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var emoji string
+		var count int
+		if err := rows.Scan(&emoji, &count); err != nil {
+			log.Printf("postgres: error unmarshaling reaction count query result: %s", err.Error())
+			continue
+		}
+		counts[emoji] = count
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	return counts, tx.Commit()
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	createRetentionPolicies = `
+create table retention_policies(
+    policy_id bigserial primary key,
+    chat_id bigint not null default 0,
+    tag text not null default '',
+    days int not null,
+    mode text not null,
+    broadcasts boolean not null default false
+);`
+
+	queryRetentionPolicies = `
+select policy_id, chat_id, tag, days, mode, broadcasts from retention_policies order by policy_id;`
+
+	insertRetentionPolicy = `
+insert into 
+    retention_policies (chat_id, tag, days, mode, broadcasts) 
+    values ($1, $2, $3, $4, $5) 
+    returning policy_id;`
+
+	deleteRetentionPolicy = `delete from retention_policies where policy_id = $1;`
+
+	// Entries wiped by metadata policy are not listed again
+	queryExpiredEntries = `
+select m.message_id, m.chat_id from messages m 
+    where m.date < $1 
+    and ($2 = 0 or m.chat_id = $2) 
+    and ($3 = '' or exists (select from unnest(m.tags) t where lower(t) = $3)) 
+    and ($4 or m.text <> '' or m.note <> '' or m.entities <> '[]'::jsonb or cardinality(m.parts) <> 0) 
+    order by m.date;`
+
+	deleteExpiredMessage = `delete from messages where message_id = $1 and chat_id = $2;`
+
+	wipeExpiredMessage = `
+update messages set text = '', note = '', entities = '[]', parts = '{}', updated = extract(epoch from now())::bigint 
+    where message_id = $1 and chat_id = $2;`
+
+	deleteExpiredReview = `delete from reviews where message_id = $1 and chat_id = $2;`
+
+	deleteExpiredRecent = `delete from recent_messages where message_id = $1 and chat_id = $2;`
+
+	deleteExpiredReactions = `delete from reactions where message_id = $1 and chat_id = $2;`
+)
+
+type retentionService struct{}
+
+func NewRetentionService() (telecollector.RetentionService, error) {
+	err := gracefulCreateTable("retention_policies", createRetentionPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &retentionService{}, nil
+}
+
+func (rs *retentionService) Policies() ([]*telecollector.RetentionPolicy, error) {
+	rows, err := db.Query(queryRetentionPolicies)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*telecollector.RetentionPolicy, 0)
+	for rows.Next() {
+		p := &telecollector.RetentionPolicy{}
+		err = rows.Scan(&p.ID, &p.ChatID, &p.Tag, &p.Days, &p.Mode, &p.Broadcasts)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+
+	return res, rows.Err()
+}
+
+func (rs *retentionService) AddPolicy(p *telecollector.RetentionPolicy) error {
+	if len(p.Tag) != 0 {
+		p.Tag = telecollector.NormalizeTag(p.Tag, unicodeNorm)
+	}
+
+	return db.QueryRow(insertRetentionPolicy, p.ChatID, p.Tag, p.Days, p.Mode, p.Broadcasts).Scan(&p.ID)
+}
+
+func (rs *retentionService) RemovePolicy(id int64) error {
+	_, err := db.Exec(deleteRetentionPolicy, id)
+	return err
+}
+
+func (rs *retentionService) Expired(p *telecollector.RetentionPolicy, before int64) ([]*telecollector.Entry, error) {
+	rows, err := db.Query(queryExpiredEntries, before, p.ChatID, p.Tag, p.Mode == telecollector.RetentionDelete)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*telecollector.Entry, 0)
+	for rows.Next() {
+		e := &telecollector.Entry{}
+		err = rows.Scan(&e.MessageID, &e.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+
+	return res, rows.Err()
+}
+
+func (rs *retentionService) Purge(p *telecollector.RetentionPolicy, msgID int64, chatID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	queries := []string{deleteExpiredReview, deleteExpiredRecent, deleteExpiredReactions}
+	if p.Mode == telecollector.RetentionDelete {
+		queries = append(queries, deleteExpiredMessage, deleteBroadcasts)
+	} else {
+		queries = append(queries, wipeExpiredMessage)
+		if p.Broadcasts {
+			queries = append(queries, deleteBroadcasts)
+		}
+	}
+
+	for _, q := range queries {
+		_, err = tx.Exec(q, msgID, chatID)
+		if err != nil {
+			return rollback(tx, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"log"
+	"sync"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const (
+	createRoutes = `
+create table routes(
+    route_id bigserial primary key,
+    chat_id bigint not null default 0,
+    tag text not null default '',
+    author_id bigint not null default 0,
+    channel_id bigint not null
+);`
+
+	queryRoutes = `select route_id, chat_id, tag, author_id, channel_id from routes order by route_id;`
+
+	insertRoute = `
+insert into 
+    routes (chat_id, tag, author_id, channel_id) 
+    values ($1, $2, $3, $4) 
+    returning route_id;`
+
+	deleteRoute = `delete from routes where route_id = $1;`
+)
+
+type routingService struct {
+	mu     sync.RWMutex
+	routes []*telecollector.Route
+}
+
+func NewRoutingService() (telecollector.RoutingService, error) {
+	err := gracefulCreateTable("routes", createRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &routingService{}
+	err = rs.loadRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+func (rs *routingService) loadRoutes() error {
+	rows, err := db.Query(queryRoutes)
+	if err != nil {
+		return err
+	}
+
+	routes := make([]*telecollector.Route, 0)
+	for rows.Next() {
+		r := telecollector.Route{}
+		if err := rows.Scan(&r.ID, &r.ChatID, &r.Tag, &r.AuthorID, &r.ChannelID); err != nil {
+			log.Printf("postgres: error unmarshaling route query result: %s", err.Error())
+			continue
+		}
+		if len(r.Tag) != 0 {
+			r.Tag = telecollector.NormalizeTag(r.Tag, unicodeNorm)
+		}
+		routes = append(routes, &r)
+	}
+
+	rs.mu.Lock()
+	rs.routes = routes
+	rs.mu.Unlock()
+
+	return rows.Close()
+}
+
+func (rs *routingService) Routes() []*telecollector.Route {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return append([]*telecollector.Route{}, rs.routes...)
+}
+
+func (rs *routingService) AddRoute(r *telecollector.Route) error {
+	if len(r.Tag) != 0 {
+		r.Tag = telecollector.NormalizeTag(r.Tag, unicodeNorm)
+	}
+
+	err := db.QueryRow(insertRoute, r.ChatID, r.Tag, r.AuthorID, r.ChannelID).Scan(&r.ID)
+	if err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	rs.routes = append(rs.routes, r)
+	rs.mu.Unlock()
+
+	return nil
+}
+
+func (rs *routingService) RemoveRoute(id int64) error {
+	_, err := db.Exec(deleteRoute, id)
+	if err != nil {
+		return err
+	}
+
+	return rs.loadRoutes()
+}
+
+func (rs *routingService) Destinations(msg *telegram.Message) []int64 {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	subj := telecollector.NewSubject(msg, unicodeNorm)
+	seen := make(map[int64]bool)
+	res := make([]int64, 0)
+	for _, r := range rs.routes {
+		if seen[r.ChannelID] || !r.Match(subj) {
+			continue
+		}
+		seen[r.ChannelID] = true
+		res = append(res, r.ChannelID)
+	}
+
+	return res
+}
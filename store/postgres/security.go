@@ -18,10 +18,13 @@ create table allowances(
     chat_id bigint, 
     modified date,
     follow bool, 
+    moderated bool not null default false,
     primary key(chat_id)
 );`
 
-	queryAllowances = `select chat_id, follow from allowances;`
+	alterAllowancesModerated = `alter table allowances add column if not exists moderated bool not null default false;`
+
+	queryAllowances = `select chat_id, follow, moderated from allowances;`
 
 	insertAllowance = `
 insert into 
@@ -29,6 +32,25 @@ insert into
     values ($1, $2, $3) 
         on conflict (chat_id) 
         do update set follow = $2, modified = $3;`
+
+	insertModeration = `
+insert into 
+    allowances (chat_id, follow, moderated, modified) 
+    values ($1, false, $2, $3) 
+        on conflict (chat_id) 
+        do update set moderated = $2, modified = $3;`
+
+	createOptOuts = `
+create table opt_outs(
+    author_id bigint primary key,
+    modified timestamp not null default now()
+);`
+
+	queryOptedOut = `select exists(select 1 from opt_outs where author_id = $1);`
+
+	insertOptOut = `insert into opt_outs (author_id) values ($1) on conflict (author_id) do nothing;`
+
+	deleteOptOut = `delete from opt_outs where author_id = $1;`
 )
 
 type credentialsService struct {
@@ -42,6 +64,16 @@ func NewCredentialService() (telecollector.CredentialService, error) {
 		return nil, err
 	}
 
+	err = migrate(alterAllowancesModerated)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gracefulCreateTable("opt_outs", createOptOuts)
+	if err != nil {
+		return nil, err
+	}
+
 	cs := &credentialsService{}
 	err = cs.loadAllowances()
 	if err != nil {
@@ -66,7 +98,7 @@ func (cs *credentialsService) loadAllowances() error {
 	cs.Allowances = make(map[int64]*telecollector.Allowance)
 	for rows.Next() {
 		a := telecollector.Allowance{}
-		if err := rows.Scan(&a.ChatID, &a.Follow); err != nil {
+		if err := rows.Scan(&a.ChatID, &a.Follow, &a.Moderated); err != nil {
 			log.Printf("postgres: error unmarshaling allowance query result: %s", err.Error())
 			continue
 		}
@@ -129,3 +161,60 @@ func (cs *credentialsService) FollowChat(chat *telegram.Chat, follow bool) error
 
 	return nil
 }
+
+func (cs *credentialsService) CheckModerated(chatID int64) bool {
+	a, ok := cs.Allowances[chatID]
+	return ok && a.Moderated
+}
+
+func (cs *credentialsService) ModerateChat(chat *telegram.Chat, moderated bool) error {
+	_, ok := cs.Allowances[chat.ID]
+	if ok {
+		cs.Allowances[chat.ID].Moderated = moderated
+	} else {
+		cs.Allowances[chat.ID] = &telecollector.Allowance{
+			ChatID:    chat.ID,
+			Moderated: moderated,
+		}
+	}
+
+	_, err := db.Exec(insertModeration, &chat.ID, &moderated, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cs *credentialsService) FollowedChats() []int64 {
+	res := make([]int64, 0)
+	for id, a := range cs.Allowances {
+		if a.Follow {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// CheckOptedOut reads opt-outs every time instead of caching them, so the member
+// opted out on one instance is skipped by every other one at once. When the store
+// can not be read the author is considered opted out rather than collected against their will.
+func (cs *credentialsService) CheckOptedOut(authorID int64) bool {
+	var out bool
+	err := db.QueryRow(queryOptedOut, authorID).Scan(&out)
+	if err != nil {
+		log.Printf("postgres: error checking opt-out of %d: %s", authorID, err.Error())
+		return true
+	}
+	return out
+}
+
+func (cs *credentialsService) OptOut(authorID int64, out bool) error {
+	query := deleteOptOut
+	if out {
+		query = insertOptOut
+	}
+
+	_, err := db.Exec(query, authorID)
+	return err
+}
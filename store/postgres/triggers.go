@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+	"github.com/lib/pq"
+)
+
+const (
+	// Trigger tags are kept next to allowances, global ones under TriggerScopeGlobal chat
+	alterAllowancesTriggers = `alter table allowances add column if not exists triggers text[] not null default '{}';`
+
+	// Tags configured before were kept in a table of their own
+	migrateTriggersTable = `
+insert into 
+    allowances (chat_id, follow, triggers, modified) 
+    select chat_id, false, array_agg(tag order by tag), now() from triggers group by chat_id 
+        on conflict (chat_id) 
+        do update set triggers = excluded.triggers;
+drop table triggers;`
+
+	queryTriggers = `select chat_id, triggers from allowances where cardinality(triggers) <> 0;`
+
+	insertTrigger = `
+insert into 
+    allowances (chat_id, follow, triggers, modified) 
+    values ($1, false, array[$2::text], $3) 
+        on conflict (chat_id) 
+        do update set triggers = array_append(array_remove(allowances.triggers, $2::text), $2::text), modified = $3;`
+
+	deleteTrigger = `update allowances set triggers = array_remove(triggers, $2::text), modified = $3 where chat_id = $1;`
+
+	createRules = `
+create table rules(
+    rule_id bigserial primary key,
+    chat_id bigint not null,
+    expression text not null
+);`
+
+	queryRules = `select rule_id, chat_id, expression from rules order by rule_id;`
+
+	insertRule = `insert into rules (chat_id, expression) values ($1, $2) returning rule_id;`
+
+	deleteRule = `delete from rules where chat_id = $1 and rule_id = $2;`
+)
+
+type triggersService struct {
+	mu       sync.RWMutex
+	triggers map[int64][]string
+	rules    map[int64][]*telecollector.Rule
+}
+
+func NewTriggerService() (telecollector.TriggerService, error) {
+	err := gracefulCreateTable("allowances", createAllowances)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate(alterAllowancesTriggers)
+	if err != nil {
+		return nil, err
+	}
+
+	var legacy bool
+	err = db.QueryRow(queryTableExistence, "triggers").Scan(&legacy)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		err = migrate(migrateTriggersTable)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = gracefulCreateTable("rules", createRules)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &triggersService{}
+	err = ts.loadTriggers()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ts.loadRules()
+	if err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+func (ts *triggersService) loadTriggers() error {
+	rows, err := db.Query(queryTriggers)
+	if err != nil {
+		return err
+	}
+
+	triggers := make(map[int64][]string)
+	for rows.Next() {
+		var chatID int64
+		var tags []string
+		if err := rows.Scan(&chatID, pq.Array(&tags)); err != nil {
+			log.Printf("postgres: error unmarshaling trigger query result: %s", err.Error())
+			continue
+		}
+		triggers[chatID] = tags
+	}
+
+	ts.mu.Lock()
+	ts.triggers = triggers
+	ts.mu.Unlock()
+
+	return rows.Close()
+}
+
+func (ts *triggersService) loadRules() error {
+	rows, err := db.Query(queryRules)
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[int64][]*telecollector.Rule)
+	for rows.Next() {
+		r := telecollector.Rule{}
+		if err := rows.Scan(&r.ID, &r.ChatID, &r.Expression); err != nil {
+			log.Printf("postgres: error unmarshaling rule query result: %s", err.Error())
+			continue
+		}
+
+		r.Matcher, err = telecollector.ParseMatcher(r.Expression, unicodeNorm)
+		if err != nil {
+			log.Printf("postgres: error parsing rule %d: %s", r.ID, err.Error())
+			continue
+		}
+		rules[r.ChatID] = append(rules[r.ChatID], &r)
+	}
+
+	ts.mu.Lock()
+	ts.rules = rules
+	ts.mu.Unlock()
+
+	return rows.Close()
+}
+
+func (ts *triggersService) Triggers(chatID int64) []string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if tags := ts.triggers[chatID]; len(tags) != 0 {
+		return append([]string{}, tags...)
+	}
+
+	if tags := ts.triggers[telecollector.TriggerScopeGlobal]; len(tags) != 0 {
+		return append([]string{}, tags...)
+	}
+
+	return []string{telecollector.NormalizeTag(telecollector.TriggerTag, unicodeNorm)}
+}
+
+func (ts *triggersService) AddTrigger(chatID int64, tag string) error {
+	_, err := db.Exec(insertTrigger, chatID, telecollector.NormalizeTag(tag, unicodeNorm), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return ts.loadTriggers()
+}
+
+func (ts *triggersService) RemoveTrigger(chatID int64, tag string) error {
+	_, err := db.Exec(deleteTrigger, chatID, telecollector.NormalizeTag(tag, unicodeNorm), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return ts.loadTriggers()
+}
+
+func (ts *triggersService) Rules(chatID int64) []*telecollector.Rule {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return append([]*telecollector.Rule{}, ts.rules[chatID]...)
+}
+
+func (ts *triggersService) AddRule(chatID int64, expr string) (*telecollector.Rule, error) {
+	m, err := telecollector.ParseMatcher(expr, unicodeNorm)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &telecollector.Rule{
+		ChatID:     chatID,
+		Expression: expr,
+		Matcher:    m,
+	}
+	err = db.QueryRow(insertRule, chatID, expr).Scan(&r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ts.mu.Lock()
+	ts.rules[chatID] = append(ts.rules[chatID], r)
+	ts.mu.Unlock()
+
+	return r, nil
+}
+
+func (ts *triggersService) RemoveRule(chatID int64, id int64) error {
+	_, err := db.Exec(deleteRule, chatID, id)
+	if err != nil {
+		return err
+	}
+
+	return ts.loadRules()
+}
+
+func (ts *triggersService) IsTriggered(msg *telegram.Message) bool {
+	subj := telecollector.NewSubject(msg, unicodeNorm)
+	if telecollector.AnyTag(ts.Triggers(msg.Chat.ID)).Match(subj) {
+		return true
+	}
+
+	for _, r := range ts.Rules(msg.Chat.ID) {
+		if r.Matcher.Match(subj) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasTrigger reports whether tags contain trigger tag of the chat
+func (ts *triggersService) HasTrigger(chatID int64, tags []string) bool {
+	subj := &telecollector.Subject{Tags: make([]string, 0, len(tags))}
+	for _, t := range tags {
+		subj.Tags = append(subj.Tags, telecollector.NormalizeTag(t, unicodeNorm))
+	}
+
+	return telecollector.AnyTag(ts.Triggers(chatID)).Match(subj)
+}
@@ -0,0 +1,366 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+
+	"github.com/kalambet/telecollector/telecollector"
+	"github.com/lib/pq"
+)
+
+const (
+	createAuditLog = `
+create table audit_log(
+    audit_id bigserial primary key,
+    at timestamp with time zone not null default now(),
+    admin_id bigint not null,
+    action text not null,
+    subject_id bigint not null,
+    details text not null default ''
+);`
+
+	insertAudit = `insert into audit_log (admin_id, action, subject_id, details) values ($1, $2, $3, $4);`
+
+	queryAuditLog = `
+select audit_id, at, admin_id, action, subject_id, details from audit_log 
+    order by audit_id desc limit $1;`
+
+	queryUserProfile = `select first, coalesce(last, ''), coalesce(username, '') from authors where author_id = $1;`
+
+	queryUserEntries = entryColumns + `, m.deleted_at` + entrySource + `
+    where m.author_id = $1 order by m.date, m.message_id;`
+
+	queryUserBroadcasts = `
+select b.message_id, b.chat_id, b.channel_id, b.broadcast_ids from broadcasts b 
+    join messages m on m.message_id = b.message_id and m.chat_id = b.chat_id 
+    where m.author_id = $1;`
+
+	// Notes of the author in their own entries are exported with the entries
+	queryUserNotes = `
+select message_id, chat_id, note from messages 
+    where note_author_id = $1 and author_id <> $1 and note <> '' order by date, message_id;`
+
+	queryCarriedBroadcasts = `
+select message_id, chat_id, channel_id, broadcast_ids from broadcasts 
+    where $1 = any(authors) order by chat_id, message_id;`
+
+	queryAuthorBroadcasts = `
+select b.channel_id, b.broadcast_ids from broadcasts b 
+    where $1 = any(b.authors) or exists (select from messages m 
+        where m.message_id = b.message_id and m.chat_id = b.chat_id and m.author_id = $1);`
+
+	queryUserReactions = `select chat_id, message_id, emoji, date from reactions where reactor_id = $1 order by date;`
+
+	// Raw messages are attributed to the sender, whatever the chat is
+	queryUserReviews = `select raw from reviews where (raw -> 'from' ->> 'id')::bigint = $1;`
+
+	queryUserRecent = `select raw from recent_messages where (raw -> 'from' ->> 'id')::bigint = $1;`
+
+	deleteUserBroadcasts = `
+delete from broadcasts b 
+    where $1 = any(b.authors) or exists (select from messages m 
+        where m.message_id = b.message_id and m.chat_id = b.chat_id and m.author_id = $1);`
+
+	deleteUserMessages = `delete from messages where author_id = $1;`
+
+	anonymizeUserMessages = `
+update messages set author_id = 0, updated = extract(epoch from now())::bigint where author_id = $1;`
+
+	deleteUserNotes = `
+update messages set note = '', note_author_id = 0, updated = extract(epoch from now())::bigint 
+    where note_author_id = $1;`
+
+	anonymizeUserNotes = `update messages set note_author_id = 0 where note_author_id = $1;`
+
+	deleteUserReviewNotes    = `update reviews set note = null, note_author_id = 0 where note_author_id = $1;`
+	anonymizeUserReviewNotes = `update reviews set note_author_id = 0 where note_author_id = $1;`
+
+	deleteUserAuthor    = `delete from authors where author_id = $1;`
+	deleteUserReactions = `delete from reactions where reactor_id = $1;`
+	deleteUserReviews   = `delete from reviews where (raw -> 'from' ->> 'id')::bigint = $1;`
+	deleteUserRecent    = `delete from recent_messages where (raw -> 'from' ->> 'id')::bigint = $1;`
+)
+
+type privacyService struct{}
+
+func NewPrivacyService() (telecollector.PrivacyService, error) {
+	err := gracefulCreateTable("audit_log", createAuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	return &privacyService{}, nil
+}
+
+func (ps *privacyService) UserData(authorID int64) (*telecollector.UserData, error) {
+	d := &telecollector.UserData{
+		AuthorID:  authorID,
+		Entries:   make([]*telecollector.UserEntry, 0),
+		Notes:     make([]*telecollector.UserNote, 0),
+		Reactions: make([]*telecollector.UserReaction, 0),
+		Exported:  time.Now().UTC(),
+	}
+
+	p := &telecollector.UserProfile{}
+	err := db.QueryRow(queryUserProfile, authorID).Scan(&p.FirstName, &p.LastName, &p.UserName)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		d.Author = p
+	}
+
+	broadcasts, err := ps.broadcastLinks(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(queryUserEntries, authorID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var forgotten sql.NullTime
+		e, err := scanEntry(rows, &forgotten)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+
+		ue := &telecollector.UserEntry{ExportRecord: telecollector.NewExportRecord(e), Broadcasts: make([]string, 0)}
+		if forgotten.Valid {
+			ue.Forgotten = &forgotten.Time
+		}
+		if links, ok := broadcasts[[2]int64{e.MessageID, e.ChatID}]; ok {
+			ue.Broadcasts = links
+		}
+		d.Entries = append(d.Entries, ue)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(queryUserNotes, authorID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		n := &telecollector.UserNote{}
+		err = rows.Scan(&n.MessageID, &n.ChatID, &n.Note)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		n.Link = telegram.MessageLink(n.ChatID, "", n.MessageID)
+		d.Notes = append(d.Notes, n)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	d.Carried, err = ps.carriedBroadcasts(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(queryUserReactions, authorID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		r := &telecollector.UserReaction{}
+		var date int64
+		err = rows.Scan(&r.ChatID, &r.MessageID, &r.Emoji, &date)
+		if err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		r.Date = time.Unix(date, 0).UTC()
+		d.Reactions = append(d.Reactions, r)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	d.Reviews, err = queryRaw(db, queryUserReviews, authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Recent, err = queryRaw(db, queryUserRecent, authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// broadcastLinks maps entries of the author to links of their broadcasts
+func (ps *privacyService) broadcastLinks(authorID int64) (map[[2]int64][]string, error) {
+	rows, err := db.Query(queryUserBroadcasts, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[[2]int64][]string)
+	for rows.Next() {
+		var msgID, chatID, channelID int64
+		var ids []int64
+		err = rows.Scan(&msgID, &chatID, &channelID, pq.Array(&ids))
+		if err != nil {
+			return nil, err
+		}
+
+		key := [2]int64{msgID, chatID}
+		for _, id := range ids {
+			res[key] = append(res[key], telegram.MessageLink(channelID, "", id))
+		}
+	}
+
+	return res, rows.Err()
+}
+
+// carriedBroadcasts lists broadcasts of other entries with content of the author
+func (ps *privacyService) carriedBroadcasts(authorID int64) ([]*telecollector.UserBroadcast, error) {
+	rows, err := db.Query(queryCarriedBroadcasts, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*telecollector.UserBroadcast, 0)
+	for rows.Next() {
+		var channelID int64
+		var ids []int64
+		ub := &telecollector.UserBroadcast{Broadcasts: make([]string, 0)}
+		err = rows.Scan(&ub.MessageID, &ub.ChatID, &channelID, pq.Array(&ids))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			ub.Broadcasts = append(ub.Broadcasts, telegram.MessageLink(channelID, "", id))
+		}
+		res = append(res, ub)
+	}
+
+	return res, rows.Err()
+}
+
+func (ps *privacyService) AuthorBroadcasts(authorID int64) ([]*telecollector.Broadcast, error) {
+	rows, err := db.Query(queryAuthorBroadcasts, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*telecollector.Broadcast, 0)
+	for rows.Next() {
+		bc := &telecollector.Broadcast{}
+		err = rows.Scan(&bc.ChannelID, pq.Array(&bc.MessageIDs))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, bc)
+	}
+
+	return res, rows.Err()
+}
+
+func (ps *privacyService) Erase(report *telecollector.ErasureReport, adminID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	messages, notes, reviewNotes := deleteUserMessages, deleteUserNotes, deleteUserReviewNotes
+	if report.Anonymized {
+		messages, notes, reviewNotes = anonymizeUserMessages, anonymizeUserNotes, anonymizeUserReviewNotes
+	}
+
+	steps := []struct {
+		query string
+		count *int64
+	}{
+		{deleteUserBroadcasts, nil},
+		{messages, &report.Entries},
+		{notes, &report.Notes},
+		{deleteUserAuthor, nil},
+		{deleteUserReactions, &report.Reactions},
+		{deleteUserReviews, &report.Reviews},
+		{reviewNotes, nil},
+		{deleteUserRecent, &report.Recent},
+	}
+	for _, st := range steps {
+		res, err := tx.Exec(st.query, report.AuthorID)
+		if err != nil {
+			return rollback(tx, err)
+		}
+		if st.count != nil {
+			*st.count, err = res.RowsAffected()
+			if err != nil {
+				return rollback(tx, err)
+			}
+		}
+	}
+
+	// Erasure is never left without its audit record and the other way around
+	_, err = tx.Exec(insertAudit, adminID, report.AuditAction(), report.AuthorID, report.Summary())
+	if err != nil {
+		return rollback(tx, err)
+	}
+
+	return tx.Commit()
+}
+
+func (ps *privacyService) Audit(adminID int64, action string, subjectID int64, details string) error {
+	_, err := db.Exec(insertAudit, adminID, action, subjectID, details)
+	return err
+}
+
+func (ps *privacyService) AuditLog(limit int) ([]*telecollector.AuditRecord, error) {
+	rows, err := db.Query(queryAuditLog, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]*telecollector.AuditRecord, 0)
+	for rows.Next() {
+		r := &telecollector.AuditRecord{}
+		err = rows.Scan(&r.ID, &r.At, &r.AdminID, &r.Action, &r.SubjectID, &r.Details)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+
+	return res, rows.Err()
+}
+
+func queryRaw(conn *sql.DB, query string, args ...interface{}) ([]json.RawMessage, error) {
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]json.RawMessage, 0)
+	for rows.Next() {
+		var raw []byte
+		err = rows.Scan(&raw)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, json.RawMessage(raw))
+	}
+
+	return res, rows.Err()
+}
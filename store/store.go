@@ -1,6 +1,8 @@
 package store
 
 import (
+	"os"
+
 	"github.com/kalambet/telecollector/store/postgres"
 	"github.com/kalambet/telecollector/telecollector"
 )
@@ -13,6 +15,63 @@ func NewCrenetialService() (telecollector.CredentialService, error) {
 	return postgres.NewCredentialService()
 }
 
+func NewRoutingService() (telecollector.RoutingService, error) {
+	return postgres.NewRoutingService()
+}
+
+func NewTriggerService() (telecollector.TriggerService, error) {
+	return postgres.NewTriggerService()
+}
+
+func NewReactionService() (telecollector.ReactionService, error) {
+	return postgres.NewReactionService()
+}
+
+func NewModerationService() (telecollector.ModerationService, error) {
+	return postgres.NewModerationService()
+}
+
+func NewAPIKeyService() (telecollector.APIKeyService, error) {
+	return postgres.NewAPIKeyService()
+}
+
+func NewRetentionService() (telecollector.RetentionService, error) {
+	return postgres.NewRetentionService()
+}
+
+func NewPrivacyService() (telecollector.PrivacyService, error) {
+	return postgres.NewPrivacyService()
+}
+
+func NewJobService() (telecollector.JobService, error) {
+	return postgres.NewJobService()
+}
+
+// JournalPostgres keeps the update journal in the database instead of a file
+const JournalPostgres = "postgres"
+
+// NewUpdateJournal opens the journal set by UPDATE_JOURNAL, either
+// `postgres` or a file path, updates are not journaled when it is empty
+func NewUpdateJournal() (telecollector.UpdateJournal, error) {
+	return OpenUpdateJournal(os.Getenv("UPDATE_JOURNAL"))
+}
+
+func OpenUpdateJournal(location string) (telecollector.UpdateJournal, error) {
+	switch location {
+	case "":
+		return nil, nil
+	case JournalPostgres:
+		return postgres.NewUpdateJournal()
+	}
+
+	return telecollector.NewFileJournal(location), nil
+}
+
+// Connect switches the store to another database, see postgres.Connect
+func Connect(url string) error {
+	return postgres.Connect(url)
+}
+
 func Shutdown() error {
 	return postgres.Shutdown()
 }
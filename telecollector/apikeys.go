@@ -0,0 +1,24 @@
+package telecollector
+
+import (
+	"time"
+)
+
+const CommandAPIKey = "apikey"
+
+// APIKey grants read-only access to the REST API,
+// only hash of the token is stored so the token is shown once on creation
+type APIKey struct {
+	ID        int64
+	Name      string
+	CreatedBy int64
+	Created   time.Time
+	LastUsed  *time.Time
+}
+
+type APIKeyService interface {
+	CreateKey(name string, adminID int64) (string, *APIKey, error)
+	Keys() ([]*APIKey, error)
+	RevokeKey(id int64) error
+	CheckKey(token string) (*APIKey, error)
+}
@@ -1,17 +1,49 @@
 package telecollector
 
-import "github.com/kalambet/telecollector/telegram"
+import (
+	"io"
+
+	"github.com/kalambet/telecollector/telegram"
+)
 
 type Bot interface {
 	GetUsername() string
-	SendMessage(text string) (int64, error)
-	EditMessage(msgID int64, text string) error
+	SetWebhook(url string, allowedUpdates []string) error
+	Channel() int64
+	ToChannel(channelID int64) Bot
+	SendMessage(text *telegram.Text) (int64, error)
+	EditMessage(msgID int64, text *telegram.Text) error
 	ForwardMessage(chatID int64, msgID int64) (int64, error)
-	ReplyBroadcast(text string, msgID int64) (int64, error)
-	ReplyMessage(text string, chatID int64, msgID int64) (int64, error)
+	CopyMessage(chatID int64, msgID int64, caption *telegram.Text) (int64, error)
+	BroadcastMessage(msg *telegram.Message) ([]int64, error)
+	ReplyBroadcast(text *telegram.Text, msgID int64) (int64, error)
+	ReplyBroadcastChain(text *telegram.Text, msgID int64) ([]int64, error)
+	EditBroadcastChain(ids []int64, text *telegram.Text) ([]int64, error)
+	ReplyMessage(text *telegram.Text, chatID int64, msgID int64) (int64, error)
+	ReplyKeyboard(text *telegram.Text, chatID int64, msgID int64, kb *telegram.InlineKeyboardMarkup) (int64, error)
+	EditReplyMarkup(chatID int64, msgID int64, kb *telegram.InlineKeyboardMarkup) error
+	EditKeyboard(text *telegram.Text, chatID int64, msgID int64, kb *telegram.InlineKeyboardMarkup) error
+	SendDocument(chatID int64, msgID int64, name string, data io.Reader, caption *telegram.Text) (int64, error)
+	AnswerCallbackQuery(queryID string, text string) error
+	AnswerInlineQuery(queryID string, results []*telegram.InlineQueryResultArticle, nextOffset string) error
+	GetChatMember(chatID int64, userID int64) (*telegram.ChatMember, error)
 	DeleteMessage(msgID int64) error
 }
 
+// telegramBot adapts telegram.Bot to Bot interface
+type telegramBot struct {
+	*telegram.Bot
+}
+
+func (b telegramBot) ToChannel(channelID int64) Bot {
+	return telegramBot{b.Bot.ToChannel(channelID)}
+}
+
 func NewBot(token string) (Bot, error) {
-	return telegram.NewBot(token)
+	bot, err := telegram.NewBot(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return telegramBot{bot}, nil
 }
@@ -0,0 +1,206 @@
+package telecollector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronDescriptors are shortcuts for the common schedules
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronDays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: cronMonths},
+	// 7 is Sunday as well
+	{name: "day of week", min: 0, max: 7, names: cronDays},
+}
+
+// Cron is a parsed cron expression: `minute hour day-of-month month day-of-week`
+// with `*`, lists, ranges and steps, or one of @hourly, @daily, @weekly, @monthly, @yearly.
+// The expression may start with `TZ=<zone>` to be evaluated in the time zone.
+type Cron struct {
+	expr     string
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	anyDay   bool
+	location *time.Location
+}
+
+func ParseCron(expr string) (*Cron, error) {
+	c := &Cron{expr: strings.TrimSpace(expr), location: time.UTC}
+
+	fields := strings.Fields(c.expr)
+	if len(fields) != 0 && (strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=")) {
+		loc, err := time.LoadLocation(fields[0][strings.Index(fields[0], "=")+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cron: unknown time zone in %q: %w", expr, err)
+		}
+		c.location = loc
+		fields = fields[1:]
+	}
+
+	if len(fields) == 1 {
+		d, ok := cronDescriptors[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("cron: unknown descriptor %q", fields[0])
+		}
+		fields = strings.Fields(d)
+	}
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron: %q should have %d fields", expr, len(cronFields))
+	}
+
+	masks := make([]uint64, len(cronFields))
+	for i, f := range cronFields {
+		m, err := f.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron: %s of %q: %w", f.name, expr, err)
+		}
+		masks[i] = m
+	}
+	c.minute, c.hour, c.dom, c.month, c.dow = masks[0], masks[1], masks[2], masks[3], masks[4]
+
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	// Like in cron, restricted day of month and day of week match either of them
+	c.anyDay = fields[2] == "*" || fields[4] == "*"
+
+	return c, nil
+}
+
+func (f cronField) parse(spec string) (uint64, error) {
+	var res uint64
+	for _, part := range strings.Split(spec, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = f.value(bounds[0])
+			if err != nil {
+				return 0, err
+			}
+			hi, err = f.value(bounds[1])
+			if err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// `5/15` means from 5 to the end with the step
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("bad range %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+
+	return res, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q is not within %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// cronSearchYears bounds the search of impossible dates like February 30
+const cronSearchYears = 5
+
+// Next is the first matching minute after the moment, zero time means never
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.In(c.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			// Truncate works with absolute time which breaks zones with half-hour offsets
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
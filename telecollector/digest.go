@@ -0,0 +1,216 @@
+package telecollector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CommandDigest = "digest"
+
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+
+	// digestUntagged groups entries collected by command or reactions without tags
+	digestUntagged = "untagged"
+)
+
+var ErrDigestSchedule = errors.New("digest: schedule should look like `daily 09:00 [Europe/Berlin] [chat=<id>]` or `weekly mon 09:00 [UTC] [chat=<id>]`")
+
+var digestWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// DigestSchedule posts the digest of the passed day or week at the local time,
+// ChatID is zero when the digest goes to the default digest chat
+type DigestSchedule struct {
+	Period   string
+	Weekday  time.Weekday
+	Hour     int
+	Minute   int
+	Location *time.Location
+	ChatID   int64
+}
+
+// ParseDigestSchedules reads `;` separated schedules, every one of them is
+// `daily HH:MM [zone] [chat=<id>]` or `weekly <mon..sun> HH:MM [zone] [chat=<id>]`
+func ParseDigestSchedules(spec string) ([]*DigestSchedule, error) {
+	res := make([]*DigestSchedule, 0)
+	for _, part := range strings.Split(spec, ";") {
+		args := strings.Fields(part)
+		if len(args) == 0 {
+			continue
+		}
+
+		ds, err := parseDigestSchedule(args)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ds)
+	}
+
+	return res, nil
+}
+
+func parseDigestSchedule(args []string) (*DigestSchedule, error) {
+	ds := &DigestSchedule{Period: strings.ToLower(args[0]), Location: time.UTC}
+	args = args[1:]
+
+	switch ds.Period {
+	case DigestDaily:
+	case DigestWeekly:
+		if len(args) == 0 {
+			return nil, ErrDigestSchedule
+		}
+		day, ok := digestWeekdays[strings.ToLower(args[0])]
+		if !ok && len(args[0]) > 3 {
+			day, ok = digestWeekdays[strings.ToLower(args[0][:3])]
+		}
+		if !ok {
+			return nil, ErrDigestSchedule
+		}
+		ds.Weekday = day
+		args = args[1:]
+	default:
+		return nil, ErrDigestSchedule
+	}
+
+	if len(args) == 0 {
+		return nil, ErrDigestSchedule
+	}
+	at, err := time.Parse("15:04", args[0])
+	if err != nil {
+		return nil, ErrDigestSchedule
+	}
+	ds.Hour, ds.Minute = at.Hour(), at.Minute()
+
+	for _, a := range args[1:] {
+		if strings.HasPrefix(a, "chat=") {
+			ds.ChatID, err = strconv.ParseInt(strings.TrimPrefix(a, "chat="), 10, 64)
+			if err != nil {
+				return nil, ErrDigestSchedule
+			}
+			continue
+		}
+
+		ds.Location, err = time.LoadLocation(a)
+		if err != nil {
+			return nil, fmt.Errorf("digest: unknown time zone %s: %w", a, err)
+		}
+	}
+
+	return ds, nil
+}
+
+// Cron is the expression the digest is scheduled with
+func (ds *DigestSchedule) Cron() string {
+	day := "*"
+	if ds.Period == DigestWeekly {
+		day = strconv.Itoa(int(ds.Weekday))
+	}
+	return fmt.Sprintf("TZ=%s %d %d * * %s", ds.Location.String(), ds.Minute, ds.Hour, day)
+}
+
+// Days is the length of the period digest covers
+func (ds *DigestSchedule) Days() int {
+	if ds.Period == DigestWeekly {
+		return 7
+	}
+	return 1
+}
+
+func (ds *DigestSchedule) String() string {
+	res := fmt.Sprintf("%s %02d:%02d %s", ds.Period, ds.Hour, ds.Minute, ds.Location.String())
+	if ds.Period == DigestWeekly {
+		res = fmt.Sprintf("%s %s %02d:%02d %s", ds.Period, ds.Weekday.String()[:3], ds.Hour, ds.Minute, ds.Location.String())
+	}
+	if ds.ChatID != 0 {
+		res += fmt.Sprintf(" chat=%d", ds.ChatID)
+	}
+	return res
+}
+
+// Digest is entries collected within the period grouped by tag and then by chat
+type Digest struct {
+	Since   time.Time
+	Until   time.Time
+	Entries int
+	Groups  []*DigestGroup
+}
+
+type DigestGroup struct {
+	Tag   string
+	Chats []*DigestChat
+}
+
+type DigestChat struct {
+	ChatID   int64
+	ChatName string
+	Entries  []*Entry
+}
+
+// BuildDigest collects entries dated within [since, until) of the chats which keep
+// accepts, nil keep takes them all. Every entry is listed once under its first tag.
+func BuildDigest(msgService MessageService, chatIDs []int64, since time.Time, until time.Time,
+	keep func(e *Entry) bool) (*Digest, error) {
+	d := &Digest{Since: since, Until: until}
+	groups := make(map[string]*DigestGroup)
+	chats := make(map[string]*DigestChat)
+
+	q := &SearchQuery{ChatIDs: chatIDs, Since: since.Unix(), Until: until.Unix() - 1, Chronological: true}
+	err := msgService.Walk(q, func(e *Entry) error {
+		if keep != nil && !keep(e) {
+			return nil
+		}
+
+		tag := digestUntagged
+		if len(e.Tags) != 0 {
+			tag = NormalizeTag(e.Tags[0], false)
+		}
+
+		g, ok := groups[tag]
+		if !ok {
+			g = &DigestGroup{Tag: tag}
+			groups[tag] = g
+			d.Groups = append(d.Groups, g)
+		}
+
+		key := fmt.Sprintf("%s %d", tag, e.ChatID)
+		c, ok := chats[key]
+		if !ok {
+			c = &DigestChat{ChatID: e.ChatID, ChatName: e.ChatName}
+			chats[key] = c
+			g.Chats = append(g.Chats, c)
+		}
+
+		c.Entries = append(c.Entries, e)
+		d.Entries++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The busiest tags come first, untagged entries are the last
+	sort.SliceStable(d.Groups, func(i, j int) bool {
+		if (d.Groups[i].Tag == digestUntagged) != (d.Groups[j].Tag == digestUntagged) {
+			return d.Groups[j].Tag == digestUntagged
+		}
+		return d.Groups[i].size() > d.Groups[j].size()
+	})
+
+	return d, nil
+}
+
+func (g *DigestGroup) size() int {
+	res := 0
+	for _, c := range g.Chats {
+		res += len(c.Entries)
+	}
+	return res
+}
@@ -0,0 +1,189 @@
+package telecollector
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const (
+	CommandExport = "export"
+
+	ExportJSONLines = "jsonl"
+	ExportCSV       = "csv"
+	ExportMarkdown  = "md"
+)
+
+var ErrExportFormat = errors.New("export: unknown format, use jsonl, csv or md")
+
+var exportColumns = []string{
+	"chat_id", "chat_name", "message_id", "author_id", "author_name",
+	"date", "updated", "tags", "text", "note", "link",
+}
+
+// ExportRecord is an entry joined with its chat and author as it is exported
+type ExportRecord struct {
+	ChatID     int64     `json:"chat_id"`
+	ChatName   string    `json:"chat_name"`
+	MessageID  int64     `json:"message_id"`
+	AuthorID   int64     `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	Date       time.Time `json:"date"`
+	Updated    time.Time `json:"updated"`
+	Tags       []string  `json:"tags"`
+	Text       string    `json:"text"`
+	Note       string    `json:"note,omitempty"`
+	Link       string    `json:"link"`
+}
+
+func NewExportRecord(e *Entry) *ExportRecord {
+	tags := e.Tags
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+
+	return &ExportRecord{
+		ChatID:     e.ChatID,
+		ChatName:   e.ChatName,
+		MessageID:  e.MessageID,
+		AuthorID:   e.AuthorID,
+		AuthorName: e.AuthorName,
+		Date:       time.Unix(e.Date, 0).UTC(),
+		Updated:    time.Unix(e.Updated, 0).UTC(),
+		Tags:       tags,
+		Text:       e.Text,
+		Note:       e.Note,
+		Link:       telegram.MessageLink(e.ChatID, "", e.MessageID),
+	}
+}
+
+// Exporter writes entries one by one in the chosen format,
+// Close flushes buffered output but leaves the underlying writer open
+type Exporter interface {
+	Write(e *Entry) error
+	Close() error
+}
+
+func NewExporter(format string, w io.Writer) (Exporter, error) {
+	switch format {
+	case ExportJSONLines:
+		return &jsonLinesExporter{enc: json.NewEncoder(w)}, nil
+	case ExportCSV:
+		return newCSVExporter(w), nil
+	case ExportMarkdown:
+		return &markdownExporter{w: w}, nil
+	}
+
+	return nil, ErrExportFormat
+}
+
+// ExportFileName is a name of the export file created now
+func ExportFileName(format string) string {
+	return fmt.Sprintf("telecollector-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+}
+
+type jsonLinesExporter struct {
+	enc *json.Encoder
+}
+
+func (x *jsonLinesExporter) Write(e *Entry) error {
+	return x.enc.Encode(NewExportRecord(e))
+}
+
+func (x *jsonLinesExporter) Close() error {
+	return nil
+}
+
+type csvExporter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVExporter(w io.Writer) *csvExporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (x *csvExporter) Write(e *Entry) error {
+	if !x.header {
+		x.header = true
+		err := x.w.Write(exportColumns)
+		if err != nil {
+			return err
+		}
+	}
+
+	r := NewExportRecord(e)
+	return x.w.Write([]string{
+		strconv.FormatInt(r.ChatID, 10), r.ChatName, strconv.FormatInt(r.MessageID, 10),
+		strconv.FormatInt(r.AuthorID, 10), r.AuthorName,
+		r.Date.Format(time.RFC3339), r.Updated.Format(time.RFC3339),
+		strings.Join(r.Tags, " "), r.Text, r.Note, r.Link,
+	})
+}
+
+func (x *csvExporter) Close() error {
+	// Empty export still gets the header, so tools know the columns
+	if !x.header {
+		err := x.w.Write(exportColumns)
+		if err != nil {
+			return err
+		}
+	}
+
+	x.w.Flush()
+	return x.w.Error()
+}
+
+type markdownExporter struct {
+	w io.Writer
+}
+
+func (x *markdownExporter) Write(e *Entry) error {
+	r := NewExportRecord(e)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", strings.TrimSpace(strings.SplitN(r.Text, "\n", 2)[0]))
+	fmt.Fprintf(&b, "*%s* · [link](%s)\n\n", e.Description(), r.Link)
+	if len(r.Tags) != 0 {
+		fmt.Fprintf(&b, "Tags: %s\n\n", strings.Join(r.Tags, " "))
+	}
+	fmt.Fprintf(&b, "%s\n\n", r.Text)
+	if len(r.Note) != 0 {
+		fmt.Fprintf(&b, "> %s\n\n", strings.Replace(r.Note, "\n", "\n> ", -1))
+	}
+	b.WriteString("---\n\n")
+
+	_, err := io.WriteString(x.w, b.String())
+	return err
+}
+
+func (x *markdownExporter) Close() error {
+	return nil
+}
+
+// Export streams every entry found by the query to the writer,
+// it returns the number of exported entries
+func Export(msgService MessageService, q *SearchQuery, format string, w io.Writer) (int, error) {
+	x, err := NewExporter(format, w)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = msgService.Walk(q, func(e *Entry) error {
+		count++
+		return x.Write(e)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, x.Close()
+}
@@ -0,0 +1,182 @@
+package telecollector
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+// FakeBot logs every call instead of talking to Telegram, sent messages
+// get increasing ids so the flows relying on them keep going.
+// Texts are not logged, they carry content of collected messages.
+type FakeBot struct {
+	Username string
+	// MemberStatus is returned for every chat member lookup
+	MemberStatus string
+
+	channel int64
+	mu      *sync.Mutex
+	lastID  *int64
+}
+
+func NewFakeBot(username string) *FakeBot {
+	var lastID int64
+	return &FakeBot{
+		Username:     username,
+		MemberStatus: telegram.ChatMemberMember,
+		mu:           &sync.Mutex{},
+		lastID:       &lastID,
+	}
+}
+
+func (b *FakeBot) nextID() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*b.lastID++
+	return *b.lastID
+}
+
+func (b *FakeBot) GetUsername() string {
+	return b.Username
+}
+
+func (b *FakeBot) SetWebhook(url string, allowedUpdates []string) error {
+	log.Printf("fakebot: setWebhook %v", allowedUpdates)
+	return nil
+}
+
+func (b *FakeBot) Channel() int64 {
+	return b.channel
+}
+
+func (b *FakeBot) ToChannel(channelID int64) Bot {
+	res := *b
+	res.channel = channelID
+	return &res
+}
+
+func (b *FakeBot) SendMessage(text *telegram.Text) (int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: sendMessage chat=%d id=%d", b.channel, id)
+	return id, nil
+}
+
+func (b *FakeBot) EditMessage(msgID int64, text *telegram.Text) error {
+	log.Printf("fakebot: editMessageText chat=%d msg=%d", b.channel, msgID)
+	return nil
+}
+
+func (b *FakeBot) ForwardMessage(chatID int64, msgID int64) (int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: forwardMessage chat=%d from=%d msg=%d id=%d", b.channel, chatID, msgID, id)
+	return id, nil
+}
+
+func (b *FakeBot) CopyMessage(chatID int64, msgID int64, caption *telegram.Text) (int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: copyMessage chat=%d from=%d msg=%d id=%d", b.channel, chatID, msgID, id)
+	return id, nil
+}
+
+func (b *FakeBot) BroadcastMessage(msg *telegram.Message) ([]int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: broadcast chat=%d msg=%d id=%d", b.channel, msg.ID, id)
+	return []int64{id}, nil
+}
+
+func (b *FakeBot) ReplyBroadcast(text *telegram.Text, msgID int64) (int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: sendMessage chat=%d reply=%d id=%d", b.channel, msgID, id)
+	return id, nil
+}
+
+func (b *FakeBot) ReplyBroadcastChain(text *telegram.Text, msgID int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	for _, part := range telegram.SplitText(text, telegram.MaxMessageLength) {
+		id, _ := b.ReplyBroadcast(part, msgID)
+		ids = append(ids, id)
+		msgID = id
+	}
+	return ids, nil
+}
+
+func (b *FakeBot) EditBroadcastChain(ids []int64, text *telegram.Text) ([]int64, error) {
+	parts := telegram.SplitText(text, telegram.MaxMessageLength)
+	res := make([]int64, 0, len(parts))
+	for i, part := range parts {
+		if i < len(ids) {
+			_ = b.EditMessage(ids[i], part)
+			res = append(res, ids[i])
+			continue
+		}
+
+		var replyTo int64
+		if len(res) != 0 {
+			replyTo = res[len(res)-1]
+		}
+		id, _ := b.ReplyBroadcast(part, replyTo)
+		res = append(res, id)
+	}
+
+	for i := len(parts); i < len(ids); i++ {
+		_ = b.DeleteMessage(ids[i])
+	}
+
+	return res, nil
+}
+
+func (b *FakeBot) ReplyMessage(text *telegram.Text, chatID int64, msgID int64) (int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: sendMessage chat=%d reply=%d id=%d", chatID, msgID, id)
+	return id, nil
+}
+
+func (b *FakeBot) ReplyKeyboard(text *telegram.Text, chatID int64, msgID int64, kb *telegram.InlineKeyboardMarkup) (int64, error) {
+	id := b.nextID()
+	log.Printf("fakebot: sendMessage chat=%d reply=%d id=%d with keyboard", chatID, msgID, id)
+	return id, nil
+}
+
+func (b *FakeBot) EditReplyMarkup(chatID int64, msgID int64, kb *telegram.InlineKeyboardMarkup) error {
+	log.Printf("fakebot: editMessageReplyMarkup chat=%d msg=%d", chatID, msgID)
+	return nil
+}
+
+func (b *FakeBot) EditKeyboard(text *telegram.Text, chatID int64, msgID int64, kb *telegram.InlineKeyboardMarkup) error {
+	log.Printf("fakebot: editMessageText chat=%d msg=%d with keyboard", chatID, msgID)
+	return nil
+}
+
+func (b *FakeBot) SendDocument(chatID int64, msgID int64, name string, data io.Reader, caption *telegram.Text) (int64, error) {
+	// The document is read through, so the writer on the other side of a pipe is not blocked
+	n, err := io.Copy(ioutil.Discard, data)
+	if err != nil {
+		return 0, err
+	}
+
+	id := b.nextID()
+	log.Printf("fakebot: sendDocument chat=%d reply=%d id=%d %s (%d bytes)", chatID, msgID, id, name, n)
+	return id, nil
+}
+
+func (b *FakeBot) AnswerCallbackQuery(queryID string, text string) error {
+	log.Printf("fakebot: answerCallbackQuery %s", queryID)
+	return nil
+}
+
+func (b *FakeBot) AnswerInlineQuery(queryID string, results []*telegram.InlineQueryResultArticle, nextOffset string) error {
+	log.Printf("fakebot: answerInlineQuery %s: %d results, next offset %q", queryID, len(results), nextOffset)
+	return nil
+}
+
+func (b *FakeBot) GetChatMember(chatID int64, userID int64) (*telegram.ChatMember, error) {
+	return &telegram.ChatMember{User: &telegram.User{ID: userID}, Status: b.MemberStatus}, nil
+}
+
+func (b *FakeBot) DeleteMessage(msgID int64) error {
+	log.Printf("fakebot: deleteMessage chat=%d msg=%d", b.channel, msgID)
+	return nil
+}
@@ -0,0 +1,233 @@
+package telecollector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UpdateJournal keeps raw updates exactly as Telegram sent them,
+// so they can be replayed later to reproduce a bug
+type UpdateJournal interface {
+	Record(raw []byte) error
+	Replay(since time.Time, fn func(at time.Time, raw []byte) error) error
+	// Expired counts updates received before the time, Truncate drops them
+	Expired(before time.Time) (int64, error)
+	Truncate(before time.Time) (int64, error)
+	// UserUpdates lists updates where any object has the user id: sender,
+	// reactor or private chat, EraseUser drops them
+	UserUpdates(userID int64) ([]json.RawMessage, error)
+	EraseUser(userID int64) (int64, error)
+}
+
+// journalRecord is a line of the file journal
+type journalRecord struct {
+	At     time.Time       `json:"at"`
+	Update json.RawMessage `json:"update"`
+}
+
+// fileJournal appends updates as JSON lines to a file
+type fileJournal struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileJournal(path string) UpdateJournal {
+	return &fileJournal{path: path}
+}
+
+func (j *fileJournal) Record(raw []byte) error {
+	line, err := json.Marshal(&journalRecord{At: time.Now().UTC(), Update: raw})
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (j *fileJournal) Replay(since time.Time, fn func(at time.Time, raw []byte) error) error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	// Updates carrying long texts do not fit default token size
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var rec journalRecord
+		err = json.Unmarshal(sc.Bytes(), &rec)
+		if err != nil {
+			return err
+		}
+		if rec.At.Before(since) {
+			continue
+		}
+
+		err = fn(rec.At, rec.Update)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+func (j *fileJournal) Expired(before time.Time) (int64, error) {
+	var n int64
+	err := j.Replay(time.Time{}, func(at time.Time, raw []byte) error {
+		if at.Before(before) {
+			n++
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (j *fileJournal) Truncate(before time.Time) (int64, error) {
+	return j.rewrite(func(rec *journalRecord) bool {
+		return !rec.At.Before(before)
+	})
+}
+
+func (j *fileJournal) UserUpdates(userID int64) ([]json.RawMessage, error) {
+	res := make([]json.RawMessage, 0)
+	err := j.Replay(time.Time{}, func(at time.Time, raw []byte) error {
+		if carriesID(raw, userID) {
+			res = append(res, append(json.RawMessage(nil), raw...))
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	return res, err
+}
+
+func (j *fileJournal) EraseUser(userID int64) (int64, error) {
+	return j.rewrite(func(rec *journalRecord) bool {
+		return !carriesID(rec.Update, userID)
+	})
+}
+
+// carriesID reports whether any object of the update has the id,
+// the same way as `$.** ? (@.id == id)` path does for the table journal
+func carriesID(raw []byte, id int64) bool {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if dec.Decode(&v) != nil {
+		return false
+	}
+	return hasID(v, strconv.FormatInt(id, 10))
+}
+
+func hasID(v interface{}, id string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if n, ok := v["id"].(json.Number); ok && n.String() == id {
+			return true
+		}
+		for _, sub := range v {
+			if hasID(sub, id) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, sub := range v {
+			if hasID(sub, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rewrite keeps only records for which keep is true, the file is written
+// next to the journal and renamed over it, so a failure leaves it intact
+func (j *fileJournal) rewrite(keep func(rec *journalRecord) bool) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	src, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmp := j.path + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	var dropped int64
+	w := bufio.NewWriter(dst)
+	sc := bufio.NewScanner(src)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var rec journalRecord
+		err = json.Unmarshal(sc.Bytes(), &rec)
+		if err != nil {
+			break
+		}
+		if !keep(&rec) {
+			dropped++
+			continue
+		}
+
+		_, _ = w.Write(sc.Bytes())
+		err = w.WriteByte('\n')
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = sc.Err()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+
+	return dropped, os.Rename(tmp, j.path)
+}
@@ -0,0 +1,466 @@
+package telecollector
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+var (
+	ErrMatcherEmpty       = errors.New("matcher: expression is empty")
+	ErrMatcherParenthesis = errors.New("matcher: unbalanced parenthesis")
+	ErrMatcherOperand     = errors.New("matcher: operand is missing")
+)
+
+// Subject is a message prepared for matching: tags are normalized
+// and text is lower-cased once instead of doing it in every matcher.
+type Subject struct {
+	Message *telegram.Message
+	Tags    []string
+	Text    string
+}
+
+func NewSubject(msg *telegram.Message, unicodeNorm bool) *Subject {
+	tags := msg.Tags()
+	for i := range tags {
+		tags[i] = NormalizeTag(tags[i], unicodeNorm)
+	}
+
+	text := msg.Text
+	if len(text) == 0 {
+		text = msg.Caption
+	}
+
+	return &Subject{
+		Message: msg,
+		Tags:    tags,
+		Text:    strings.ToLower(text),
+	}
+}
+
+// Matcher decides whether a message should be collected or routed.
+type Matcher interface {
+	Match(s *Subject) bool
+	String() string
+}
+
+// TagExact matches normalized tag as is.
+type TagExact string
+
+func (m TagExact) Match(s *Subject) bool {
+	for _, t := range s.Tags {
+		if t == string(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m TagExact) String() string {
+	return string(m)
+}
+
+// TagPrefix matches tags starting with the normalized prefix, e.g. `#read*`.
+type TagPrefix string
+
+func (m TagPrefix) Match(s *Subject) bool {
+	for _, t := range s.Tags {
+		if strings.HasPrefix(t, string(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m TagPrefix) String() string {
+	return string(m) + "*"
+}
+
+// TagRegex matches tags against case-insensitive expression, e.g. `#/^#a\d+$/`.
+type TagRegex struct {
+	Re *regexp.Regexp
+}
+
+func (m TagRegex) Match(s *Subject) bool {
+	for _, t := range s.Tags {
+		if m.Re.MatchString(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m TagRegex) String() string {
+	return fmt.Sprintf("#/%s/", strings.TrimPrefix(m.Re.String(), "(?i)"))
+}
+
+// Keyword matches a whole word or phrase in the text ignoring case.
+type Keyword string
+
+func (m Keyword) Match(s *Subject) bool {
+	kw := string(m)
+	if len(kw) == 0 {
+		return false
+	}
+
+	for from := 0; from < len(s.Text); {
+		i := strings.Index(s.Text[from:], kw)
+		if i < 0 {
+			return false
+		}
+		start, end := from+i, from+i+len(kw)
+		if isWordBoundary(s.Text, start, end) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s.Text[start:])
+		from = start + size
+	}
+	return false
+}
+
+func (m Keyword) String() string {
+	if strings.ContainsAny(string(m), " \t") {
+		return fmt.Sprintf("%q", string(m))
+	}
+	return string(m)
+}
+
+func isWordBoundary(text string, start int, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// TextRegex matches message text against case-insensitive expression.
+type TextRegex struct {
+	Re *regexp.Regexp
+}
+
+func (m TextRegex) Match(s *Subject) bool {
+	return m.Re.MatchString(s.Text)
+}
+
+func (m TextRegex) String() string {
+	return fmt.Sprintf("/%s/", strings.TrimPrefix(m.Re.String(), "(?i)"))
+}
+
+// Domain matches links pointing to the domain or any of its subdomains.
+type Domain string
+
+func (m Domain) Match(s *Subject) bool {
+	for _, link := range s.Message.URLs() {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+
+		host := strings.ToLower(u.Hostname())
+		if host == string(m) || strings.HasSuffix(host, "."+string(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Domain) String() string {
+	return "domain:" + string(m)
+}
+
+// Author matches any message written by the user.
+type Author int64
+
+func (m Author) Match(s *Subject) bool {
+	return s.Message.Author().ID == int64(m)
+}
+
+func (m Author) String() string {
+	return fmt.Sprintf("author:%d", int64(m))
+}
+
+type And []Matcher
+
+func (m And) Match(s *Subject) bool {
+	for _, sub := range m {
+		if !sub.Match(s) {
+			return false
+		}
+	}
+	return len(m) != 0
+}
+
+func (m And) String() string {
+	return joinMatchers(m, " and ")
+}
+
+type Or []Matcher
+
+func (m Or) Match(s *Subject) bool {
+	for _, sub := range m {
+		if sub.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Or) String() string {
+	return joinMatchers(m, " or ")
+}
+
+type Not struct {
+	Matcher Matcher
+}
+
+func (m Not) Match(s *Subject) bool {
+	return !m.Matcher.Match(s)
+}
+
+func (m Not) String() string {
+	return "not " + m.Matcher.String()
+}
+
+func joinMatchers(ms []Matcher, op string) string {
+	parts := make([]string, 0, len(ms))
+	for _, m := range ms {
+		parts = append(parts, m.String())
+	}
+	return "(" + strings.Join(parts, op) + ")"
+}
+
+// AnyTag matches when the message has any of the normalized tags.
+func AnyTag(tags []string) Matcher {
+	res := make(Or, 0, len(tags))
+	for _, t := range tags {
+		res = append(res, TagExact(t))
+	}
+	return res
+}
+
+// ParseMatcher builds matcher from expression like
+// `#a51 or (#jobs and not #spam)`, `#read* "must read"`, `/rust|go/`.
+//
+// Terms:
+//   - `#tag` exact tag, `#tag*` tag prefix, `#/re/` case-insensitive tag regex
+//   - `/re/` case-insensitive regex over text
+//   - `word` or `"some phrase"` keyword
+//   - `domain:example.com` link to the domain or its subdomains
+//   - `author:<id>` any message of the author
+//
+// Operators are `not` (`!`), `and` (`&&`, or just a space) and `or` (`||`)
+// in order of precedence, parenthesis group terms.
+func ParseMatcher(expr string, unicodeNorm bool) (Matcher, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrMatcherEmpty
+	}
+
+	p := &matcherParser{tokens: tokens, unicodeNorm: unicodeNorm}
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, ErrMatcherParenthesis
+	}
+
+	return m, nil
+}
+
+type matcherParser struct {
+	tokens      []string
+	pos         int
+	unicodeNorm bool
+}
+
+func (p *matcherParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *matcherParser) parseOr() (Matcher, error) {
+	res := Or{}
+	for {
+		m, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+
+		tok := strings.ToLower(p.peek())
+		if tok != "or" && tok != "||" {
+			break
+		}
+		p.pos++
+	}
+
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+func (p *matcherParser) parseAnd() (Matcher, error) {
+	res := And{}
+	for {
+		m, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+
+		tok := strings.ToLower(p.peek())
+		if tok == "and" || tok == "&&" {
+			p.pos++
+			continue
+		}
+		if tok == "" || tok == ")" || tok == "or" || tok == "||" {
+			break
+		}
+	}
+
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+func (p *matcherParser) parseUnary() (Matcher, error) {
+	tok := p.peek()
+	switch strings.ToLower(tok) {
+	case "":
+		return nil, ErrMatcherOperand
+	case "not", "!":
+		p.pos++
+		m, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{m}, nil
+	case "(":
+		p.pos++
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, ErrMatcherParenthesis
+		}
+		p.pos++
+		return m, nil
+	case ")", "and", "&&", "or", "||":
+		return nil, fmt.Errorf("%w: unexpected %q", ErrMatcherOperand, tok)
+	}
+
+	p.pos++
+	return parseTerm(tok, p.unicodeNorm)
+}
+
+func parseTerm(tok string, unicodeNorm bool) (Matcher, error) {
+	switch {
+	case strings.HasPrefix(tok, "#/") && strings.HasSuffix(tok, "/") && len(tok) > 3:
+		re, err := regexp.Compile("(?i)" + tok[2:len(tok)-1])
+		if err != nil {
+			return nil, err
+		}
+		return TagRegex{re}, nil
+	case strings.HasPrefix(tok, "#") && strings.HasSuffix(tok, "*"):
+		return TagPrefix(NormalizeTag(strings.TrimSuffix(tok, "*"), unicodeNorm)), nil
+	case strings.HasPrefix(tok, "#"):
+		return TagExact(NormalizeTag(tok, unicodeNorm)), nil
+	case strings.HasPrefix(tok, "/") && strings.HasSuffix(tok, "/") && len(tok) > 2:
+		re, err := regexp.Compile("(?i)" + tok[1:len(tok)-1])
+		if err != nil {
+			return nil, err
+		}
+		return TextRegex{re}, nil
+	case strings.HasPrefix(tok, "domain:") && len(tok) > len("domain:"):
+		return Domain(strings.ToLower(strings.TrimPrefix(tok, "domain:"))), nil
+	case strings.HasPrefix(tok, "author:"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(tok, "author:"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("matcher: invalid author id in %q", tok)
+		}
+		return Author(id), nil
+	case strings.HasPrefix(tok, `"`) && strings.HasSuffix(tok, `"`) && len(tok) > 1:
+		return Keyword(strings.ToLower(tok[1 : len(tok)-1])), nil
+	}
+
+	return Keyword(strings.ToLower(tok)), nil
+}
+
+// tokenize splits expression into parenthesis, operators and terms,
+// regexes and quoted phrases are kept as single tokens with their delimiters.
+func tokenize(expr string) ([]string, error) {
+	tokens := make([]string, 0)
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '!' && (i+1 == len(runes) || runes[i+1] != '='):
+			tokens = append(tokens, "!")
+			i++
+		case r == '/' || r == '"' || (r == '#' && i+1 < len(runes) && runes[i+1] == '/'):
+			start := i
+			delim := r
+			if r == '#' {
+				delim = '/'
+				i++
+			}
+			i++
+			for i < len(runes) && runes[i] != delim {
+				if runes[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("matcher: unterminated %c in %q", delim, string(runes[start:]))
+			}
+			i++
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		}
+	}
+
+	return tokens, nil
+}
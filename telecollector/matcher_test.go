@@ -0,0 +1,224 @@
+package telecollector
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+var testHashtag = regexp.MustCompile(`#[\w*]+`)
+
+// testSubject builds the subject of ASCII text written by the author,
+// hashtags of the text become entities and links are attached as text links
+func testSubject(text string, authorID int64, links ...string) *Subject {
+	msg := &telegram.Message{
+		ID:   1,
+		From: &telegram.User{ID: authorID, FirstName: "Test"},
+		Chat: &telegram.Chat{ID: -100},
+		Text: text,
+	}
+	for _, loc := range testHashtag.FindAllStringIndex(text, -1) {
+		msg.Entities = append(msg.Entities, &telegram.MessageEntity{
+			Type: telegram.EntityTypeHashtag, Offset: loc[0], Length: loc[1] - loc[0]})
+	}
+	for _, l := range links {
+		msg.Entities = append(msg.Entities, &telegram.MessageEntity{
+			Type: telegram.EntityTypeTextLink, Offset: 0, Length: 1, URL: l})
+	}
+	return NewSubject(msg, false)
+}
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`#Jobs`, `#jobs`},
+		{`#read*`, `#read*`},
+		{`#/^#a\d+$/`, `#/^#a\d+$/`},
+		{`/rust|go/`, `/rust|go/`},
+		{`Word`, `word`},
+		{`"Must Read"`, `"must read"`},
+		{`domain:Example.COM`, `domain:example.com`},
+		{`author:42`, `author:42`},
+		{`#a #b`, `(#a and #b)`},
+		{`#a and #b or #c`, `((#a and #b) or #c)`},
+		{`#a or #b and #c`, `(#a or (#b and #c))`},
+		{`#a || #b && #c`, `(#a or (#b and #c))`},
+		{`not #a and #b`, `(not #a and #b)`},
+		{`! #a or #b`, `(not #a or #b)`},
+		{`not (#a or #b)`, `not (#a or #b)`},
+		{`(#a or #b) and #c`, `((#a or #b) and #c)`},
+		{`#a and (#b or (#c and not #d))`, `(#a and (#b or (#c and not #d)))`},
+		{`NOT #a AND #b OR #c`, `((not #a and #b) or #c)`},
+		{`"a (b) or c" #x`, `("a (b) or c" and #x)`},
+		{`/a b/ or #x`, `(/a b/ or #x)`},
+		{`/a\/b/`, `/a\/b/`},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMatcher(tt.expr, false)
+		if err != nil {
+			t.Errorf("ParseMatcher(%q) error: %s", tt.expr, err)
+			continue
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("ParseMatcher(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseMatcherErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  error
+	}{
+		{``, ErrMatcherEmpty},
+		{`   `, ErrMatcherEmpty},
+		{`(#a`, ErrMatcherParenthesis},
+		{`#a)`, ErrMatcherParenthesis},
+		{`(#a or #b))`, ErrMatcherParenthesis},
+		{`#a and`, ErrMatcherOperand},
+		{`or #a`, ErrMatcherOperand},
+		{`#a or`, ErrMatcherOperand},
+		{`#a and or #b`, ErrMatcherOperand},
+		{`not`, ErrMatcherOperand},
+		{`()`, ErrMatcherOperand},
+		{`"unterminated`, nil},
+		{`/unterminated`, nil},
+		{`#/unterminated`, nil},
+		{`/(/`, nil},
+		{`#/[/`, nil},
+		{`author:me`, nil},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMatcher(tt.expr, false)
+		if err == nil {
+			t.Errorf("ParseMatcher(%q) = %s, want error", tt.expr, m)
+			continue
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("ParseMatcher(%q) error = %q, want %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestKeywordBoundaries(t *testing.T) {
+	tests := []struct {
+		keyword string
+		text    string
+		want    bool
+	}{
+		{"go", "Go is fun", true},
+		{"go", "let's go", true},
+		{"go", "go, go, go!", true},
+		{"go", "(go)", true},
+		{"go", "google it", false},
+		{"go", "ago", false},
+		{"go", "go_lang", false},
+		{"go", "go2", false},
+		{"go", "algo go", true},
+		{"go", "", false},
+		{"must read", "This is a MUST READ today", true},
+		{"must read", "must reading", false},
+		{"must read", "must  read", false},
+		{"кот", "Мой кот спит", true},
+		{"кот", "котик спит", false},
+		{"", "anything", false},
+	}
+
+	for _, tt := range tests {
+		s := testSubject(tt.text, 1)
+		if got := Keyword(tt.keyword).Match(s); got != tt.want {
+			t.Errorf("Keyword(%q).Match(%q) = %t, want %t", tt.keyword, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	s := testSubject("Reading list: #ReadLater #a51 about Rust and Go", 42,
+		"https://blog.example.com/post", "news.org/a")
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`#readlater`, true},
+		{`#ReadLater`, true},
+		{`#read`, false},
+		{`#read*`, true},
+		{`#write*`, false},
+		{`#/^#a\d+$/`, true},
+		{`#/^#A\d+$/`, true},
+		{`#/^#b\d+$/`, false},
+		{`/rust|python/`, true},
+		{`/RUST/`, true},
+		{`/java/`, false},
+		{`rust`, true},
+		{`rus`, false},
+		{`"rust and go"`, true},
+		{`"go and rust"`, false},
+		{`domain:example.com`, true},
+		{`domain:blog.example.com`, true},
+		{`domain:ample.com`, false},
+		{`domain:news.org`, true},
+		{`domain:org`, true},
+		{`author:42`, true},
+		{`author:7`, false},
+		{`#a51 and rust`, true},
+		{`#a51 and java`, false},
+		{`java or #a51`, true},
+		{`java or python`, false},
+		{`not java`, true},
+		{`not #a51`, false},
+		{`#a51 and not (java or python)`, true},
+		{`#a51 and not (java or rust)`, false},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMatcher(tt.expr, false)
+		if err != nil {
+			t.Errorf("ParseMatcher(%q) error: %s", tt.expr, err)
+			continue
+		}
+		if got := m.Match(s); got != tt.want {
+			t.Errorf("%q matches %t, want %t", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestMatchEmptyGroups(t *testing.T) {
+	s := testSubject("#a", 1)
+	if (And{}).Match(s) {
+		t.Error("empty And matches")
+	}
+	if (Or{}).Match(s) {
+		t.Error("empty Or matches")
+	}
+	if !AnyTag([]string{"#b", "#a"}).Match(s) {
+		t.Error("AnyTag does not match")
+	}
+	if AnyTag(nil).Match(s) {
+		t.Error("AnyTag of no tags matches")
+	}
+}
+
+func TestMatchUnicodeNorm(t *testing.T) {
+	// fullwidth letters are folded to ASCII only with normalization on
+	msg := &telegram.Message{Text: "#ｇｏ", Chat: &telegram.Chat{ID: -100},
+		Entities: []*telegram.MessageEntity{{Type: telegram.EntityTypeHashtag, Offset: 0, Length: 3}}}
+
+	m, err := ParseMatcher("#go", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Match(NewSubject(msg, true)) {
+		t.Error("normalized tag does not match")
+	}
+	if m.Match(NewSubject(msg, false)) {
+		t.Error("tag matches without normalization")
+	}
+}
@@ -1,6 +1,12 @@
 package telecollector
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/kalambet/telecollector/telegram"
 )
 
@@ -9,6 +15,9 @@ const (
 	CommandFollow   = "follow"
 	CommandUnfollow = "unfollow"
 	CommandWhoami   = "whoami"
+	CommandCollect  = "collect"
+	CommandSave     = "save"
+	CommandForget   = "forget"
 )
 
 type MessageAction string
@@ -24,6 +33,142 @@ type MessageContext struct {
 	ConnectedMessageID int64
 	UpdateID           int64
 	Action             MessageAction
+	// Note is an optional comment of the collector broadcasted after the message
+	Note *telegram.Text
+	// NoteAuthorID is the collector who wrote the note
+	NoteAuthorID int64
+}
+
+// Entry is a collected message as it is stored
+type Entry struct {
+	MessageID int64
+	ChatID    int64
+	AuthorID  int64
+	Date      int64
+	Updated   int64
+	Text      string
+	Entities  []*telegram.MessageEntity
+	Tags      []string
+	Note      string
+
+	// Parts are texts of the messages appended to the entry one by one
+	Parts []string
+
+	ChatName   string
+	AuthorName string
+
+	// Highlight is a text fragment with search matches wrapped
+	// into HighlightStart and HighlightStop markers, set only by Search
+	Highlight string
+}
+
+// Description is a short `author · chat · date` line describing the entry
+func (e *Entry) Description() string {
+	parts := make([]string, 0, 3)
+	if len(e.AuthorName) != 0 {
+		parts = append(parts, e.AuthorName)
+	}
+	if len(e.ChatName) != 0 {
+		parts = append(parts, e.ChatName)
+	}
+	parts = append(parts, time.Unix(e.Date, 0).UTC().Format("2006-01-02"))
+	return strings.Join(parts, " · ")
+}
+
+const (
+	CommandSearch = "search"
+
+	HighlightStart = "\x01"
+	HighlightStop  = "\x02"
+)
+
+var ErrSearchFilter = errors.New("search: invalid filter")
+
+// ErrEntryForgotten is returned on saving the message of forgotten entry,
+// it stays forgotten even when the message is tagged or edited again
+var ErrEntryForgotten = errors.New("messages: entry is forgotten")
+
+// TagCount is a tag with the number of entries carrying it
+type TagCount struct {
+	Tag     string
+	Entries int64
+}
+
+// ChatInfo is a chat entries were collected from
+type ChatInfo struct {
+	ID      int64
+	Name    string
+	Entries int64
+}
+
+// AuthorInfo is an author of collected entries
+type AuthorInfo struct {
+	ID       int64
+	Name     string
+	UserName string
+	Entries  int64
+}
+
+// SearchQuery selects entries matching full-text query and all filters,
+// zero values and nil slices mean no filtering, ChatIDs restricts to the chats
+type SearchQuery struct {
+	Text     string
+	Tags     []string
+	ChatIDs  []int64
+	AuthorID int64
+	Since    int64
+	Until    int64
+	Offset   int
+	Limit    int
+
+	// UpdatedSince selects entries saved, edited or appended since the time
+	UpdatedSince int64
+
+	// Chronological lists the oldest entries first unless ranked by text
+	Chronological bool
+}
+
+// ParseSearchQuery reads filters from command arguments, the rest is the query:
+// `#tag chat:<id> author:<id> since:2020-01-31 until:2020-02-28 words...`
+func ParseSearchQuery(args []string) (*SearchQuery, error) {
+	q := &SearchQuery{}
+	words := make([]string, 0, len(args))
+	for _, a := range args {
+		var err error
+		switch {
+		case strings.HasPrefix(a, "#") && len(a) > 1:
+			q.Tags = append(q.Tags, NormalizeTag(a, false))
+		case strings.HasPrefix(a, "chat:"):
+			var id int64
+			id, err = strconv.ParseInt(strings.TrimPrefix(a, "chat:"), 10, 64)
+			q.ChatIDs = append(q.ChatIDs, id)
+		case strings.HasPrefix(a, "author:"):
+			q.AuthorID, err = strconv.ParseInt(strings.TrimPrefix(a, "author:"), 10, 64)
+		case strings.HasPrefix(a, "since:"):
+			var t time.Time
+			t, err = time.Parse("2006-01-02", strings.TrimPrefix(a, "since:"))
+			q.Since = t.Unix()
+		case strings.HasPrefix(a, "until:"):
+			var t time.Time
+			t, err = time.Parse("2006-01-02", strings.TrimPrefix(a, "until:"))
+			// until is inclusive, so the whole day is taken
+			q.Until = t.Add(24*time.Hour).Unix() - 1
+		default:
+			words = append(words, a)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrSearchFilter, a)
+		}
+	}
+
+	q.Text = strings.Join(words, " ")
+	return q, nil
+}
+
+// Content returns stored text of the entry along with its entities
+func (e *Entry) Content() *telegram.Text {
+	return telegram.EntitiesText(e.Text, e.Entities)
 }
 
 type CommandContext struct {
@@ -31,11 +176,28 @@ type CommandContext struct {
 	CommandName  string
 	CommandPrams interface{}
 	Receiver     string
+	UpdateID     int64
+}
+
+// Args returns command arguments split by whitespace
+func (c *CommandContext) Args() []string {
+	args, _ := c.CommandPrams.([]string)
+	return args
 }
 
 type MessageService interface {
-	Save(ctx *MessageContext) (string, error)
-	LogBroadcast(msg *telegram.Message, bcID int64) error
-	FindBroadcast(msgID int64, chatID int64) (int64, error)
+	Save(ctx *MessageContext) (*telegram.Text, error)
+	LogBroadcast(msg *telegram.Message, bc *Broadcast) error
+	FindBroadcasts(msgID int64, chatID int64) ([]*Broadcast, error)
 	CheckConnected(msg *telegram.Message) (bool, error)
+	IsCollected(msgID int64, chatID int64) (bool, error)
+	FindEntry(msgID int64, chatID int64) (*Entry, error)
+	Forget(msgID int64, chatID int64) error
+	Search(q *SearchQuery) ([]*Entry, error)
+	Walk(q *SearchQuery, fn func(e *Entry) error) error
+	// EntryIDs lists ids of entries found by the query, the rest of fields is empty
+	EntryIDs(q *SearchQuery) ([]*Entry, error)
+	Tags() ([]*TagCount, error)
+	Chats() ([]*ChatInfo, error)
+	Authors() ([]*AuthorInfo, error)
 }
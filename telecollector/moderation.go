@@ -0,0 +1,36 @@
+package telecollector
+
+import (
+	"errors"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const (
+	CommandModerate = "moderate"
+
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Review is a saved entry of a moderated chat waiting for admin decision,
+// message and note are kept to broadcast the entry once it is approved.
+type Review struct {
+	MessageID       int64
+	ChatID          int64
+	ReviewMessageID int64
+	Status          string
+	Message         *telegram.Message
+	Note            *telegram.Text
+	NoteAuthorID    int64
+}
+
+// ErrReviewDecided is returned when the review is not pending anymore
+var ErrReviewDecided = errors.New("moderation: review is already decided")
+
+type ModerationService interface {
+	Enqueue(ctx *MessageContext, reviewMsgID int64) error
+	FindReview(msgID int64, chatID int64) (*Review, error)
+	Decide(msgID int64, chatID int64, status string, adminID int64) error
+}
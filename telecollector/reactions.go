@@ -0,0 +1,30 @@
+package telecollector
+
+import (
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const CommandReaction = "reaction"
+
+// ReactionTrigger collects a message of the chat once it gets
+// Threshold reactions with the Emoji.
+type ReactionTrigger struct {
+	ChatID    int64
+	Emoji     string
+	Threshold int
+}
+
+// ReactionService keeps reaction triggers and recent messages of followed
+// chats: reaction updates carry only message id, so the content has to be
+// remembered beforehand. Triggers under TriggerScopeGlobal apply to chats
+// which have none of their own.
+type ReactionService interface {
+	ReactionTriggers(chatID int64) []*ReactionTrigger
+	AddReactionTrigger(t *ReactionTrigger) error
+	RemoveReactionTrigger(chatID int64, emoji string) error
+	Remember(msg *telegram.Message) error
+	Recall(chatID int64, msgID int64) (*telegram.Message, error)
+	// Purge drops remembered messages and reactions older than the reaction window
+	Purge() (int64, error)
+	React(r *telegram.MessageReactionUpdated) (map[string]int, error)
+}
@@ -0,0 +1,116 @@
+package telecollector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	CommandRetention = "retention"
+
+	// RetentionDelete removes entries completely
+	RetentionDelete = "delete"
+	// RetentionMetadata wipes text, note and entities keeping ids, author, date and tags
+	RetentionMetadata = "metadata"
+)
+
+var ErrRetentionPolicy = errors.New("retention: policy is `<days> [chat=<chat_id>] [tag=<#tag>] [delete|metadata] [broadcasts]`")
+
+// RetentionPolicy purges entries older than Days matching all non-empty predicates,
+// every policy is applied on its own, so the shortest matching one wins
+type RetentionPolicy struct {
+	ID         int64
+	ChatID     int64
+	Tag        string
+	Days       int
+	Mode       string
+	Broadcasts bool
+}
+
+// RetentionReport tells what the policy purged or would purge on dry run
+type RetentionReport struct {
+	Policy     *RetentionPolicy
+	Entries    int
+	Broadcasts int
+	Failed     int
+	DryRun     bool
+}
+
+type RetentionService interface {
+	Policies() ([]*RetentionPolicy, error)
+	AddPolicy(p *RetentionPolicy) error
+	RemovePolicy(id int64) error
+	// Expired lists ids of entries dated before the time which the policy has not purged yet,
+	// forgotten entries are listed too as they still keep the content
+	Expired(p *RetentionPolicy, before int64) ([]*Entry, error)
+	// Purge applies the policy to the entry, review copies and reactions are always dropped
+	// and broadcasts log only when the policy deletes broadcasts or the entry
+	Purge(p *RetentionPolicy, msgID int64, chatID int64) error
+}
+
+func (p *RetentionPolicy) String() string {
+	parts := []string{fmt.Sprintf("%d: %s after %d days", p.ID, p.Mode, p.Days)}
+	if p.ChatID != 0 {
+		parts = append(parts, fmt.Sprintf("chat=%d", p.ChatID))
+	}
+	if len(p.Tag) != 0 {
+		parts = append(parts, fmt.Sprintf("tag=%s", p.Tag))
+	}
+	if p.Broadcasts {
+		parts = append(parts, "with broadcasts")
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseRetentionPolicy reads policy from command arguments:
+// `<days> [chat=<chat_id>] [tag=<#tag>] [delete|metadata] [broadcasts]`
+func ParseRetentionPolicy(args []string) (*RetentionPolicy, error) {
+	if len(args) == 0 {
+		return nil, ErrRetentionPolicy
+	}
+
+	p := &RetentionPolicy{Mode: RetentionDelete}
+	var err error
+	p.Days, err = strconv.Atoi(args[0])
+	if err != nil || p.Days < 1 {
+		return nil, ErrRetentionPolicy
+	}
+
+	for _, a := range args[1:] {
+		switch {
+		case a == RetentionDelete || a == RetentionMetadata:
+			p.Mode = a
+		case a == "broadcasts":
+			p.Broadcasts = true
+		case strings.HasPrefix(a, "chat="):
+			p.ChatID, err = strconv.ParseInt(strings.TrimPrefix(a, "chat="), 10, 64)
+			if err != nil {
+				return nil, ErrRetentionPolicy
+			}
+		case strings.HasPrefix(a, "tag="):
+			p.Tag = NormalizeTag(strings.TrimPrefix(a, "tag="), false)
+		default:
+			return nil, ErrRetentionPolicy
+		}
+	}
+
+	return p, nil
+}
+
+func (r *RetentionReport) String() string {
+	verb := "purged"
+	if r.DryRun {
+		verb = "would purge"
+	}
+
+	res := fmt.Sprintf("%s: %s %d entries", r.Policy.String(), verb, r.Entries)
+	if r.Policy.Broadcasts {
+		res += fmt.Sprintf(", %d broadcast messages", r.Broadcasts)
+	}
+	if r.Failed != 0 {
+		res += fmt.Sprintf(", %d failed", r.Failed)
+	}
+	return res
+}
@@ -0,0 +1,123 @@
+package telecollector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const CommandRoute = "route"
+
+var (
+	ErrRouteChannelMissing = errors.New("route: destination channel id is missing")
+	ErrRoutePredicate      = errors.New("route: invalid predicate")
+)
+
+// Route sends entries matching all non-empty predicates into the channel.
+type Route struct {
+	ID        int64
+	ChatID    int64
+	Tag       string
+	AuthorID  int64
+	ChannelID int64
+}
+
+type Broadcast struct {
+	ChannelID  int64
+	MessageIDs []int64
+	// Authors wrote parts of the broadcast besides the entry author:
+	// the message the entry replies to or the collector note
+	Authors []int64
+	// Attributed broadcast ends with the attribution replied to the broadcasted message
+	Attributed bool
+}
+
+// NewBroadcast composes broadcast of the message sent by Bot.BroadcastMessage
+// and the text chain replied to it, the attribution reply goes last
+func NewBroadcast(channelID int64, head []int64, chain []int64) *Broadcast {
+	bc := &Broadcast{ChannelID: channelID, MessageIDs: append(append([]int64{}, head[:1]...), chain...)}
+	if len(head) > 1 {
+		bc.MessageIDs = append(bc.MessageIDs, head[1:]...)
+		bc.Attributed = true
+	}
+	return bc
+}
+
+type RoutingService interface {
+	Routes() []*Route
+	AddRoute(r *Route) error
+	RemoveRoute(id int64) error
+	Destinations(msg *telegram.Message) []int64
+}
+
+func (r *Route) Match(s *Subject) bool {
+	if r.ChatID != 0 && r.ChatID != s.Message.Chat.ID {
+		return false
+	}
+
+	if r.AuthorID != 0 && r.AuthorID != s.Message.Author().ID {
+		return false
+	}
+
+	if len(r.Tag) != 0 {
+		return TagExact(r.Tag).Match(s)
+	}
+
+	return true
+}
+
+func (r *Route) String() string {
+	parts := []string{fmt.Sprintf("%d: ➜ %d", r.ID, r.ChannelID)}
+	if r.ChatID != 0 {
+		parts = append(parts, fmt.Sprintf("chat=%d", r.ChatID))
+	}
+	if len(r.Tag) != 0 {
+		parts = append(parts, fmt.Sprintf("tag=%s", r.Tag))
+	}
+	if r.AuthorID != 0 {
+		parts = append(parts, fmt.Sprintf("author=%d", r.AuthorID))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseRoute reads route from command arguments:
+// `<channel_id> [chat=<chat_id>] [tag=<#tag>] [author=<author_id>]`
+func ParseRoute(args []string) (*Route, error) {
+	if len(args) == 0 {
+		return nil, ErrRouteChannelMissing
+	}
+
+	r := &Route{}
+	var err error
+	r.ChannelID, err = strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, ErrRouteChannelMissing
+	}
+
+	for _, a := range args[1:] {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%w: %s", ErrRoutePredicate, a)
+		}
+
+		switch kv[0] {
+		case "chat":
+			r.ChatID, err = strconv.ParseInt(kv[1], 10, 64)
+		case "author":
+			r.AuthorID, err = strconv.ParseInt(kv[1], 10, 64)
+		case "tag":
+			r.Tag = NormalizeTag(kv[1], false)
+		default:
+			err = ErrRoutePredicate
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrRoutePredicate, a)
+		}
+	}
+
+	return r, nil
+}
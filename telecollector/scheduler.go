@@ -0,0 +1,161 @@
+package telecollector
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// JobService persists job runs and elects the process which runs a job,
+// Lock does not wait and reports false while another process holds the job
+type JobService interface {
+	LastRun(name string) (time.Time, error)
+	Lock(name string) (bool, error)
+	Unlock(name string) error
+	Finish(name string, at time.Time, jobErr error) error
+}
+
+// Job runs periodically, at is the scheduled time of the run
+// even when the run is late, e.g. it catches up after downtime
+type Job struct {
+	Name     string
+	Schedule *Cron
+	Run      func(at time.Time) error
+}
+
+// Scheduler runs every job at its schedule in one of the processes sharing the store,
+// a run missed while no process was up is made once on start
+type Scheduler struct {
+	jobService JobService
+	jobs       []*Job
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func NewScheduler(jobService JobService) *Scheduler {
+	return &Scheduler{jobService: jobService, stop: make(chan struct{})}
+}
+
+// Add registers the job, jobs added after Start are not run
+func (sc *Scheduler) Add(name string, expr string, run func(at time.Time) error) error {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+
+	for _, j := range sc.jobs {
+		if j.Name == name {
+			return fmt.Errorf("scheduler: job %s is added already", name)
+		}
+	}
+
+	sc.jobs = append(sc.jobs, &Job{Name: name, Schedule: c, Run: run})
+	return nil
+}
+
+func (sc *Scheduler) Jobs() []*Job {
+	return sc.jobs
+}
+
+func (sc *Scheduler) Start() {
+	for _, j := range sc.jobs {
+		log.Printf("scheduler: job %s runs at %s", j.Name, j.Schedule.String())
+		sc.wg.Add(1)
+		go sc.loop(j)
+	}
+}
+
+// Stop waits for the running jobs to finish
+func (sc *Scheduler) Stop() {
+	close(sc.stop)
+	sc.wg.Wait()
+}
+
+func (sc *Scheduler) loop(j *Job) {
+	defer sc.wg.Done()
+
+	var prev time.Time
+	for {
+		next, err := sc.due(j)
+		if err != nil {
+			log.Printf("scheduler: error reading job %s state: %s", j.Name, err.Error())
+			next = j.Schedule.Next(time.Now())
+		}
+		// The run taken by another process is not retried, so it is not made twice
+		if !next.After(prev) {
+			next = j.Schedule.Next(time.Now())
+		}
+		prev = next
+		if next.IsZero() {
+			log.Printf("scheduler: job %s is never due", j.Name)
+			return
+		}
+
+		select {
+		case <-sc.stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		sc.runOnce(j, next)
+	}
+}
+
+// due is the time of the next run, it is in the past when a run was missed
+func (sc *Scheduler) due(j *Job) (time.Time, error) {
+	last, err := sc.jobService.LastRun(j.Name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if last.IsZero() {
+		return j.Schedule.Next(time.Now()), nil
+	}
+	return j.Schedule.Next(last), nil
+}
+
+// runOnce makes the run planned at the time unless another process holds the job or has made the run already
+func (sc *Scheduler) runOnce(j *Job, planned time.Time) {
+	locked, err := sc.jobService.Lock(j.Name)
+	if err != nil {
+		log.Printf("scheduler: error locking job %s: %s", j.Name, err.Error())
+		return
+	}
+	if !locked {
+		return
+	}
+	defer func() {
+		err := sc.jobService.Unlock(j.Name)
+		if err != nil {
+			log.Printf("scheduler: error unlocking job %s: %s", j.Name, err.Error())
+		}
+	}()
+
+	// The state is read again under the lock, another process may have just finished the run
+	last, err := sc.jobService.LastRun(j.Name)
+	if err != nil {
+		log.Printf("scheduler: error reading job %s state: %s", j.Name, err.Error())
+		return
+	}
+	if !last.Before(planned) {
+		return
+	}
+
+	// Only the latest of missed runs is made
+	now := time.Now()
+	at := planned
+	for n := j.Schedule.Next(at); !n.IsZero() && !n.After(now); n = j.Schedule.Next(n) {
+		at = n
+	}
+
+	log.Printf("scheduler: running job %s scheduled at %s", j.Name, at.Format(time.RFC3339))
+	jobErr := j.Run(at)
+	if jobErr != nil {
+		log.Printf("scheduler: job %s failed: %s", j.Name, jobErr.Error())
+	}
+
+	err = sc.jobService.Finish(j.Name, at, jobErr)
+	if err != nil {
+		log.Printf("scheduler: error saving job %s state: %s", j.Name, err.Error())
+	}
+}
@@ -2,13 +2,24 @@ package telecollector
 
 import "github.com/kalambet/telecollector/telegram"
 
+const (
+	CommandOptOut = "optout"
+	CommandOptIn  = "optin"
+)
+
 type Allowance struct {
-	ChatID int64
-	Follow bool
+	ChatID    int64
+	Follow    bool
+	Moderated bool
 }
 
 type CredentialService interface {
 	CheckAdmin(int64) bool
 	CheckChat(int64) bool
 	FollowChat(*telegram.Chat, bool) error
+	FollowedChats() []int64
+	CheckModerated(int64) bool
+	ModerateChat(*telegram.Chat, bool) error
+	CheckOptedOut(int64) bool
+	OptOut(int64, bool) error
 }
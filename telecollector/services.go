@@ -0,0 +1,16 @@
+package telecollector
+
+// Services bundles storage backed services the bot relies on
+type Services struct {
+	Messages    MessageService
+	Credentials CredentialService
+	Routing     RoutingService
+	Triggers    TriggerService
+	Reactions   ReactionService
+	Moderation  ModerationService
+	APIKeys     APIKeyService
+	Retention   RetentionService
+	Privacy     PrivacyService
+	Journal     UpdateJournal
+	Jobs        JobService
+}
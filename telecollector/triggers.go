@@ -0,0 +1,67 @@
+package telecollector
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const (
+	CommandTrigger = "trigger"
+	CommandRule    = "rule"
+
+	// TriggerScopeGlobal is a chat id under which global trigger tags are kept
+	TriggerScopeGlobal int64 = 0
+)
+
+// Rule collects messages of the chat matching the expression
+// even if they have no trigger tag, see ParseMatcher for the syntax.
+type Rule struct {
+	ID         int64
+	ChatID     int64
+	Expression string
+	Matcher    Matcher
+}
+
+// TriggerService keeps tags and rules which make a message collected.
+// Tags configured for a chat replace the global ones, and TriggerTag is used
+// when there are no tags configured at all. Rules are configured per chat
+// and apply in addition to tags.
+type TriggerService interface {
+	Triggers(chatID int64) []string
+	AddTrigger(chatID int64, tag string) error
+	RemoveTrigger(chatID int64, tag string) error
+	Rules(chatID int64) []*Rule
+	AddRule(chatID int64, expr string) (*Rule, error)
+	RemoveRule(chatID int64, id int64) error
+	IsTriggered(msg *telegram.Message) bool
+	HasTrigger(chatID int64, tags []string) bool
+}
+
+// NormalizeTag makes tag comparable: it is lower-cased and prefixed with `#`.
+// With unicodeNorm fullwidth forms are folded to ASCII and invisible
+// format characters (zero-width joiners, variation selectors) are dropped.
+func NormalizeTag(tag string, unicodeNorm bool) string {
+	tag = strings.TrimSpace(tag)
+	if unicodeNorm {
+		tag = strings.Map(foldRune, tag)
+	}
+
+	tag = strings.ToLower(tag)
+	if !strings.HasPrefix(tag, "#") {
+		tag = "#" + tag
+	}
+
+	return tag
+}
+
+func foldRune(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		return r - 0xFF01 + '!'
+	case unicode.Is(unicode.Cf, r), unicode.Is(unicode.Variation_Selector, r):
+		return -1
+	}
+	return r
+}
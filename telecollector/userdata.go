@@ -0,0 +1,147 @@
+package telecollector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	CommandUserData = "userdata"
+
+	AuditUserExport    = "userdata_export"
+	AuditUserErase     = "userdata_erase"
+	AuditUserAnonymize = "userdata_anonymize"
+)
+
+// UserData is everything stored about the author, raw messages of moderation queue,
+// reactions buffer and update journal are kept as Telegram sent them with file ids of media.
+// The store leaves Updates empty, they come from the update journal wherever it is kept.
+type UserData struct {
+	AuthorID  int64             `json:"author_id"`
+	Author    *UserProfile      `json:"author"`
+	Entries   []*UserEntry      `json:"entries"`
+	Notes     []*UserNote       `json:"notes"`
+	Carried   []*UserBroadcast  `json:"carried_broadcasts"`
+	Reactions []*UserReaction   `json:"reactions"`
+	Reviews   []json.RawMessage `json:"reviews"`
+	Recent    []json.RawMessage `json:"recent_messages"`
+	Updates   []json.RawMessage `json:"journaled_updates"`
+	Exported  time.Time         `json:"exported"`
+}
+
+type UserProfile struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	UserName  string `json:"username,omitempty"`
+}
+
+// UserEntry is the collected message of the author, forgotten ones included
+type UserEntry struct {
+	*ExportRecord
+	Forgotten  *time.Time `json:"forgotten,omitempty"`
+	Broadcasts []string   `json:"broadcasts"`
+}
+
+// UserNote is the collector note the author attached to someone else's entry
+type UserNote struct {
+	ChatID    int64  `json:"chat_id"`
+	MessageID int64  `json:"message_id"`
+	Note      string `json:"note"`
+	Link      string `json:"link"`
+}
+
+// UserBroadcast is the broadcast of someone else's entry which carries content
+// of the author: the message the entry replies to or their collector note
+type UserBroadcast struct {
+	ChatID     int64    `json:"chat_id"`
+	MessageID  int64    `json:"message_id"`
+	Broadcasts []string `json:"broadcasts"`
+}
+
+type UserReaction struct {
+	ChatID    int64     `json:"chat_id"`
+	MessageID int64     `json:"message_id"`
+	Emoji     string    `json:"emoji"`
+	Date      time.Time `json:"date"`
+}
+
+// ErasureReport tells what was removed, anonymized entries are kept without the author
+type ErasureReport struct {
+	AuthorID         int64
+	Anonymized       bool
+	Entries          int64
+	Notes            int64
+	Broadcasts       int
+	BroadcastsFailed []string
+	Reactions        int64
+	Reviews          int64
+	Recent           int64
+	Updates          int64
+}
+
+type AuditRecord struct {
+	ID        int64
+	At        time.Time
+	AdminID   int64
+	Action    string
+	SubjectID int64
+	Details   string
+}
+
+type PrivacyService interface {
+	UserData(authorID int64) (*UserData, error)
+	// AuthorBroadcasts lists broadcasts of the author entries along with
+	// broadcasts of other entries carrying content of the author
+	AuthorBroadcasts(authorID int64) ([]*Broadcast, error)
+	// Erase deletes the author of the report with every trace of them, anonymized
+	// entries and notes are kept with no author, broadcasts log is dropped either way.
+	// Counts are added to the report which goes to the audit log in the same transaction.
+	Erase(report *ErasureReport, adminID int64) error
+	Audit(adminID int64, action string, subjectID int64, details string) error
+	AuditLog(limit int) ([]*AuditRecord, error)
+}
+
+func (d *UserData) String() string {
+	return fmt.Sprintf("author %d: %d entries, %d notes, %d broadcasts of other entries, %d reactions, %d reviews, %d recent messages, %d journaled updates",
+		d.AuthorID, len(d.Entries), len(d.Notes), len(d.Carried), len(d.Reactions), len(d.Reviews), len(d.Recent), len(d.Updates))
+}
+
+func (r *ErasureReport) String() string {
+	verb := "erased"
+	if r.Anonymized {
+		verb = "anonymized"
+	}
+
+	res := fmt.Sprintf("author %d %s: %d entries, %d notes, %d broadcast messages deleted, %d reactions, %d reviews, %d recent messages, %d journaled updates",
+		r.AuthorID, verb, r.Entries, r.Notes, r.Broadcasts, r.Reactions, r.Reviews, r.Recent, r.Updates)
+	if len(r.BroadcastsFailed) != 0 {
+		res += fmt.Sprintf("; %d broadcast messages must be deleted by hand", len(r.BroadcastsFailed))
+		for _, link := range r.BroadcastsFailed {
+			res += "\n  " + link
+		}
+	}
+	return res
+}
+
+// AuditAction is the audit log action of the erasure
+func (r *ErasureReport) AuditAction() string {
+	if r.Anonymized {
+		return AuditUserAnonymize
+	}
+	return AuditUserErase
+}
+
+// Summary is the first line of the report without links of failed broadcasts
+func (r *ErasureReport) Summary() string {
+	return strings.SplitN(r.String(), "\n", 2)[0]
+}
+
+func (r *AuditRecord) String() string {
+	res := fmt.Sprintf("%d: %s %s %d by %d", r.ID, r.At.UTC().Format("2006-01-02 15:04"), r.Action, r.SubjectID, r.AdminID)
+	if len(r.Details) != 0 {
+		res += " (" + r.Details + ")"
+	}
+	return res
+}
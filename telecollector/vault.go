@@ -0,0 +1,277 @@
+package telecollector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kalambet/telecollector/telegram"
+)
+
+const (
+	vaultEntriesDir = "entries"
+	vaultTagsDir    = "tags"
+	vaultStateFile  = ".telecollector-sync.json"
+)
+
+// vaultState is kept in the vault between runs, notes it lists are enough
+// to rebuild tag index pages without reading every entry again
+type vaultState struct {
+	LastSync int64                 `json:"last_sync"`
+	Notes    map[string]*vaultNote `json:"notes"`
+}
+
+type vaultNote struct {
+	Title string   `json:"title"`
+	Date  int64    `json:"date"`
+	Tags  []string `json:"tags"`
+}
+
+// VaultReport tells what was changed in the vault by the sync
+type VaultReport struct {
+	Written   int
+	Removed   int
+	TagPages  int
+	Full      bool
+	SyncedAt  time.Time
+	SyncSince time.Time
+}
+
+// SyncVault writes a Markdown note with YAML front matter per entry into dir
+// along with tag index pages. Only entries updated since the previous run are
+// written unless full is set or the vault is new, notes of entries which are
+// gone or do not match the query anymore are removed.
+func SyncVault(msgService MessageService, dir string, q *SearchQuery, full bool) (*VaultReport, error) {
+	state, err := loadVaultState(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VaultReport{SyncedAt: time.Now().UTC(), Full: full || state.LastSync == 0}
+	if !report.Full {
+		report.SyncSince = time.Unix(state.LastSync, 0).UTC()
+	}
+
+	for _, sub := range []string{vaultEntriesDir, vaultTagsDir} {
+		err = os.MkdirAll(filepath.Join(dir, sub), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Everything saved while the sync runs is taken by the next one
+	since := state.LastSync
+	state.LastSync = report.SyncedAt.Unix()
+
+	// Deleted entries leave nothing to sync by, so notes are checked against
+	// every entry matching the query: forgotten, purged or retagged ones go away
+	live, err := msgService.EntryIDs(q)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]bool, len(live))
+	for _, e := range live {
+		keep[vaultNoteKey(e)] = true
+	}
+	for name := range state.Notes {
+		if i := strings.IndexByte(name, '_'); i >= 0 && keep[name[i:]] {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(dir, vaultEntriesDir, name+".md"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		delete(state.Notes, name)
+		report.Removed++
+	}
+
+	sq := *q
+	if !report.Full {
+		sq.UpdatedSince = since
+	}
+	// Message date never changes on edit, so the note is rewritten in place
+	err = msgService.Walk(&sq, func(e *Entry) error {
+		broadcasts, err := msgService.FindBroadcasts(e.MessageID, e.ChatID)
+		if err != nil {
+			return err
+		}
+
+		name := VaultNoteName(e)
+		err = ioutil.WriteFile(filepath.Join(dir, vaultEntriesDir, name+".md"), []byte(vaultNoteContent(e, broadcasts)), 0644)
+		if err != nil {
+			return err
+		}
+
+		state.Notes[name] = &vaultNote{Title: vaultTitle(e), Date: e.Date, Tags: vaultTags(e.Tags)}
+		report.Written++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.TagPages, err = writeVaultTags(dir, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, saveVaultState(dir, state)
+}
+
+// VaultNoteName is a stable file name of the entry note without extension
+func VaultNoteName(e *Entry) string {
+	return fmt.Sprintf("%s_%d_%d", time.Unix(e.Date, 0).UTC().Format("2006-01-02"), e.ChatID, e.MessageID)
+}
+
+func loadVaultState(dir string) (*vaultState, error) {
+	state := &vaultState{Notes: make(map[string]*vaultNote)}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, vaultStateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(raw, state)
+	if err != nil {
+		return nil, fmt.Errorf("vault: broken sync state, run full sync: %w", err)
+	}
+	if state.Notes == nil {
+		state.Notes = make(map[string]*vaultNote)
+	}
+
+	return state, nil
+}
+
+func saveVaultState(dir string, state *vaultState) error {
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, vaultStateFile), raw, 0644)
+}
+
+// vaultNoteKey is the note name without date, entry ids come without it
+func vaultNoteKey(e *Entry) string {
+	return fmt.Sprintf("_%d_%d", e.ChatID, e.MessageID)
+}
+
+func vaultNoteContent(e *Entry, broadcasts []*Broadcast) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	writeYAML(&b, "title", vaultTitle(e))
+	writeYAML(&b, "author", e.AuthorName)
+	writeYAML(&b, "author_id", e.AuthorID)
+	writeYAML(&b, "chat", e.ChatName)
+	writeYAML(&b, "chat_id", e.ChatID)
+	writeYAML(&b, "message_id", e.MessageID)
+	writeYAML(&b, "date", time.Unix(e.Date, 0).UTC().Format(time.RFC3339))
+	writeYAML(&b, "updated", time.Unix(e.Updated, 0).UTC().Format(time.RFC3339))
+	writeYAML(&b, "tags", vaultTags(e.Tags))
+	writeYAML(&b, "source", telegram.MessageLink(e.ChatID, "", e.MessageID))
+	for _, bc := range broadcasts {
+		if len(bc.MessageIDs) != 0 && bc.MessageIDs[0] != 0 {
+			writeYAML(&b, "broadcast", telegram.MessageLink(bc.ChannelID, "", bc.MessageIDs[0]))
+			break
+		}
+	}
+	b.WriteString("---\n\n")
+
+	b.WriteString(e.Text)
+	b.WriteString("\n")
+	if len(e.Note) != 0 {
+		b.WriteString("\n> ")
+		b.WriteString(strings.Replace(e.Note, "\n", "\n> ", -1))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// writeYAML writes the value as JSON which is a valid YAML flow scalar or sequence
+func writeYAML(b *strings.Builder, key string, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		raw = []byte(`""`)
+	}
+	fmt.Fprintf(b, "%s: %s\n", key, raw)
+}
+
+func vaultTitle(e *Entry) string {
+	title := strings.TrimSpace(strings.SplitN(e.Text, "\n", 2)[0])
+	if len(title) == 0 {
+		return "Untitled"
+	}
+	return title
+}
+
+// vaultTags strips `#` since front matter tags are written without it,
+// separators are replaced so every tag stays a single file name
+func vaultTags(tags []string) []string {
+	res := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimPrefix(NormalizeTag(t, false), "#"))
+		if len(t) != 0 && !seen[t] {
+			seen[t] = true
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// writeVaultTags rewrites tag index pages and removes the ones without entries
+func writeVaultTags(dir string, state *vaultState) (int, error) {
+	index := make(map[string][]string)
+	for name, n := range state.Notes {
+		for _, t := range n.Tags {
+			index[t] = append(index[t], name)
+		}
+	}
+
+	for tag, names := range index {
+		// The most recent entries come first
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+		var b strings.Builder
+		b.WriteString("---\n")
+		writeYAML(&b, "tag", tag)
+		writeYAML(&b, "entries", len(names))
+		b.WriteString("---\n\n")
+		fmt.Fprintf(&b, "# #%s\n\n", tag)
+		for _, name := range names {
+			fmt.Fprintf(&b, "- [[%s/%s|%s]]\n", vaultEntriesDir, name, strings.NewReplacer("]", "", "|", "").Replace(state.Notes[name].Title))
+		}
+
+		err := ioutil.WriteFile(filepath.Join(dir, vaultTagsDir, tag+".md"), []byte(b.String()), 0644)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, vaultTagsDir))
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		tag := strings.TrimSuffix(f.Name(), ".md")
+		if _, ok := index[tag]; ok || !strings.HasSuffix(f.Name(), ".md") {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(dir, vaultTagsDir, f.Name()))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(index), nil
+}
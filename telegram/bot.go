@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"strconv"
@@ -12,29 +14,53 @@ import (
 
 var (
 	CommandToMethod = map[string]string{
-		"getMe":           http.MethodGet,
-		"sendMessage":     http.MethodPost,
-		"editMessageText": http.MethodPost,
-		"forwardMessage":  http.MethodPost,
-		"deleteMessage":   http.MethodPost,
+		"getMe":                  http.MethodGet,
+		"sendMessage":            http.MethodPost,
+		"editMessageText":        http.MethodPost,
+		"forwardMessage":         http.MethodPost,
+		"copyMessage":            http.MethodPost,
+		"setWebhook":             http.MethodPost,
+		"answerCallbackQuery":    http.MethodPost,
+		"editMessageReplyMarkup": http.MethodPost,
+		"answerInlineQuery":      http.MethodPost,
+		"getChatMember":          http.MethodPost,
+		"deleteMessage":          http.MethodPost,
+		"sendDocument":           http.MethodPost,
 	}
 )
 
+const (
+	MaxMessageLength = 4096
+	MaxCaptionLength = 1024
+
+	BroadcastModeForward = "forward"
+	BroadcastModeCopy    = "copy"
+)
+
 type Bot struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Name     string `json:"first_name"`
-	channel  int64
-	token    string
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	Name        string `json:"first_name"`
+	channel     int64
+	token       string
+	mode        string
+	attribution bool
 }
 
+// apiURL is the Bot API server, tests point it to a local one
+var apiURL = "https://api.telegram.org"
+
 func apiRequest(token string, cmd string, body []byte) ([]byte, error) {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", token, cmd)
-	req, err := http.NewRequest(CommandToMethod[cmd], url, bytes.NewReader(body))
+	return apiCall(token, cmd, "application/json; charset=utf-8", bytes.NewReader(body))
+}
+
+func apiCall(token string, cmd string, contentType string, body io.Reader) ([]byte, error) {
+	url := fmt.Sprintf("%s/bot%s/%s", apiURL, token, cmd)
+	req, err := http.NewRequest(CommandToMethod[cmd], url, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Content-Type", contentType)
 
 	cli := http.Client{}
 	resp, err := cli.Do(req)
@@ -75,6 +101,21 @@ func NewBot(token string) (*Bot, error) {
 		bot.channel = 0
 	}
 
+	bot.mode = os.Getenv("TG_BROADCAST_MODE")
+	switch bot.mode {
+	case BroadcastModeForward, BroadcastModeCopy:
+	case "":
+		bot.mode = BroadcastModeForward
+	default:
+		log.Printf("telegram: unknown broadcast mode %q, falling back to %q", bot.mode, BroadcastModeForward)
+		bot.mode = BroadcastModeForward
+	}
+
+	bot.attribution, err = strconv.ParseBool(os.Getenv("TG_BROADCAST_ATTRIBUTION"))
+	if err != nil {
+		bot.attribution = false
+	}
+
 	bot.token = token
 	return &bot, nil
 }
@@ -83,28 +124,114 @@ func (b *Bot) apiRequest(cmd string, body []byte) ([]byte, error) {
 	return apiRequest(b.token, cmd, body)
 }
 
+// SetWebhook registers the endpoint and update types Telegram should deliver.
+func (b *Bot) SetWebhook(url string, allowedUpdates []string) error {
+	msg := struct {
+		URL            string   `json:"url"`
+		AllowedUpdates []string `json:"allowed_updates"`
+	}{
+		URL:            url,
+		AllowedUpdates: allowedUpdates,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.apiRequest("setWebhook", body)
+	return err
+}
+
+func (b *Bot) AnswerInlineQuery(queryID string, results []*InlineQueryResultArticle, nextOffset string) error {
+	msg := struct {
+		QueryID    string                      `json:"inline_query_id"`
+		Results    []*InlineQueryResultArticle `json:"results"`
+		CacheTime  int                         `json:"cache_time"`
+		IsPersonal bool                        `json:"is_personal"`
+		NextOffset string                      `json:"next_offset"`
+	}{
+		QueryID:    queryID,
+		Results:    results,
+		CacheTime:  60,
+		IsPersonal: true,
+		NextOffset: nextOffset,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.apiRequest("answerInlineQuery", body)
+	return err
+}
+
+func (b *Bot) GetChatMember(chatID int64, userID int64) (*ChatMember, error) {
+	msg := struct {
+		ChatId int64 `json:"chat_id"`
+		UserID int64 `json:"user_id"`
+	}{
+		ChatId: chatID,
+		UserID: userID,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.apiRequest("getChatMember", body)
+	if err != nil {
+		return nil, err
+	}
+
+	member := ChatMember{}
+	err = json.Unmarshal(resp, &member)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// ToChannel returns a copy of the bot which broadcasts into the given channel.
+func (b *Bot) ToChannel(channelID int64) *Bot {
+	res := *b
+	res.channel = channelID
+	return &res
+}
+
+func (b *Bot) Channel() int64 {
+	return b.channel
+}
+
 func (b *Bot) GetUsername() string {
 	return b.Username
 }
 
-func (b *Bot) SendMessage(text string) (int64, error) {
+func (b *Bot) SendMessage(text *Text) (int64, error) {
 	if b.channel == 0 {
 		return 0, nil
 	}
 
 	msg := struct {
-		ChatId int64  `json:"chat_id"`
-		Text   string `json:"text"`
+		ChatId    int64            `json:"chat_id"`
+		Text      string           `json:"text"`
+		ParseMode string           `json:"parse_mode,omitempty"`
+		Entities  []*MessageEntity `json:"entities,omitempty"`
 	}{
-		ChatId: b.channel,
-		Text:   text,
+		ChatId:    b.channel,
+		Text:      text.Text,
+		ParseMode: text.ParseMode,
+		Entities:  text.SendEntities(),
 	}
 
 	body, err := json.Marshal(&msg)
 	if err != nil {
 		return 0, err
 	}
-	log.Printf("Send Message: %s", body)
+	log.Printf("telegram: sendMessage chat=%d", msg.ChatId)
 
 	resp, err := b.apiRequest("sendMessage", body)
 	if err != nil {
@@ -120,26 +247,123 @@ func (b *Bot) SendMessage(text string) (int64, error) {
 	return respMsg.ID, nil
 }
 
-func (b *Bot) ReplyBroadcast(text string, msgID int64) (int64, error) {
+func (b *Bot) ReplyBroadcast(text *Text, msgID int64) (int64, error) {
 	return b.ReplyMessage(text, b.channel, msgID)
 }
 
-func (b *Bot) ReplyMessage(text string, chatID int64, msgID int64) (int64, error) {
+// ReplyBroadcastChain replies to the broadcast message with the text split
+// into parts fitting Telegram limit, every part replies to the previous one.
+// IDs of all sent parts are returned in order.
+func (b *Bot) ReplyBroadcastChain(text *Text, msgID int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	for _, part := range SplitText(text, MaxMessageLength) {
+		id, err := b.ReplyBroadcast(part, msgID)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+		msgID = id
+	}
+
+	return ids, nil
+}
+
+// EditBroadcastChain updates chain of broadcast messages with the new text.
+// Existing parts are edited in place, missing ones are replied to the last
+// part and redundant ones are deleted. IDs of the resulting chain are returned.
+func (b *Bot) EditBroadcastChain(ids []int64, text *Text) ([]int64, error) {
+	parts := SplitText(text, MaxMessageLength)
+	res := make([]int64, 0, len(parts))
+	for i, part := range parts {
+		if i < len(ids) {
+			err := b.EditMessage(ids[i], part)
+			if err != nil {
+				return res, err
+			}
+			res = append(res, ids[i])
+			continue
+		}
+
+		var replyTo int64
+		if len(res) != 0 {
+			replyTo = res[len(res)-1]
+		}
+		id, err := b.ReplyBroadcast(part, replyTo)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, id)
+	}
+
+	for i := len(parts); i < len(ids); i++ {
+		err := b.DeleteMessage(ids[i])
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+func (b *Bot) ReplyMessage(text *Text, chatID int64, msgID int64) (int64, error) {
+	msg := struct {
+		ChatId           int64            `json:"chat_id"`
+		Text             string           `json:"text"`
+		ParseMode        string           `json:"parse_mode,omitempty"`
+		Entities         []*MessageEntity `json:"entities,omitempty"`
+		ReplyToMessageID int64            `json:"reply_to_message_id,omitempty"`
+	}{
+		ChatId:           chatID,
+		Text:             text.Text,
+		ParseMode:        text.ParseMode,
+		Entities:         text.SendEntities(),
+		ReplyToMessageID: msgID,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("telegram: sendMessage chat=%d reply=%d", msg.ChatId, msg.ReplyToMessageID)
+
+	resp, err := b.apiRequest("sendMessage", body)
+	if err != nil {
+		return 0, err
+	}
+
+	respMsg := Message{}
+	err = json.Unmarshal(resp, &respMsg)
+	if err != nil {
+		return 0, nil
+	}
+
+	return respMsg.ID, nil
+}
+
+// ReplyKeyboard sends the text with inline keyboard attached
+// into the chat as a reply to the message, if msgID is not 0.
+func (b *Bot) ReplyKeyboard(text *Text, chatID int64, msgID int64, kb *InlineKeyboardMarkup) (int64, error) {
 	msg := struct {
-		ChatId           int64  `json:"chat_id"`
-		Text             string `json:"text"`
-		ReplyToMessageID int64  `json:"reply_to_message_id"`
+		ChatId           int64                 `json:"chat_id"`
+		Text             string                `json:"text"`
+		ParseMode        string                `json:"parse_mode,omitempty"`
+		Entities         []*MessageEntity      `json:"entities,omitempty"`
+		ReplyToMessageID int64                 `json:"reply_to_message_id,omitempty"`
+		ReplyMarkup      *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
 	}{
 		ChatId:           chatID,
-		Text:             text,
+		Text:             text.Text,
+		ParseMode:        text.ParseMode,
+		Entities:         text.SendEntities(),
 		ReplyToMessageID: msgID,
+		ReplyMarkup:      kb,
 	}
 
 	body, err := json.Marshal(&msg)
 	if err != nil {
 		return 0, err
 	}
-	log.Printf("Reply Message: %s", body)
+	log.Printf("telegram: sendMessage chat=%d reply=%d with keyboard", msg.ChatId, msg.ReplyToMessageID)
 
 	resp, err := b.apiRequest("sendMessage", body)
 	if err != nil {
@@ -155,26 +379,163 @@ func (b *Bot) ReplyMessage(text string, chatID int64, msgID int64) (int64, error
 	return respMsg.ID, nil
 }
 
-func (b *Bot) EditMessage(msgID int64, text string) error {
+// EditReplyMarkup replaces inline keyboard of the message, nil removes it.
+func (b *Bot) EditReplyMarkup(chatID int64, msgID int64, kb *InlineKeyboardMarkup) error {
+	msg := struct {
+		ChatId      int64                 `json:"chat_id"`
+		MsgID       int64                 `json:"message_id"`
+		ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+	}{
+		ChatId:      chatID,
+		MsgID:       msgID,
+		ReplyMarkup: kb,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+	log.Printf("telegram: editMessageReplyMarkup chat=%d msg=%d", msg.ChatId, msg.MsgID)
+
+	_, err = b.apiRequest("editMessageReplyMarkup", body)
+	return err
+}
+
+// EditKeyboard replaces text and inline keyboard of the message at once.
+func (b *Bot) EditKeyboard(text *Text, chatID int64, msgID int64, kb *InlineKeyboardMarkup) error {
+	msg := struct {
+		ChatId      int64                 `json:"chat_id"`
+		MsgID       int64                 `json:"message_id"`
+		Text        string                `json:"text"`
+		ParseMode   string                `json:"parse_mode,omitempty"`
+		Entities    []*MessageEntity      `json:"entities,omitempty"`
+		ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+	}{
+		ChatId:      chatID,
+		MsgID:       msgID,
+		Text:        text.Text,
+		ParseMode:   text.ParseMode,
+		Entities:    text.SendEntities(),
+		ReplyMarkup: kb,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+	log.Printf("telegram: editMessageText chat=%d msg=%d with keyboard", msg.ChatId, msg.MsgID)
+
+	_, err = b.apiRequest("editMessageText", body)
+	return err
+}
+
+// SendDocument uploads the file read from data as a reply to the message,
+// the file is streamed into the request so it is never kept in memory as a whole.
+func (b *Bot) SendDocument(chatID int64, msgID int64, name string, data io.Reader, caption *Text) (int64, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		err := writeDocumentForm(form, chatID, msgID, name, data, caption)
+		if err == nil {
+			err = form.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	resp, err := apiCall(b.token, "sendDocument", form.FormDataContentType(), pr)
+	// Unblock the writer if the request failed before reading the whole form
+	_ = pr.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	respMsg := Message{}
+	err = json.Unmarshal(resp, &respMsg)
+	if err != nil {
+		return 0, err
+	}
+
+	return respMsg.ID, nil
+}
+
+func writeDocumentForm(form *multipart.Writer, chatID int64, msgID int64, name string, data io.Reader, caption *Text) error {
+	fields := map[string]string{"chat_id": strconv.FormatInt(chatID, 10)}
+	if msgID != 0 {
+		fields["reply_to_message_id"] = strconv.FormatInt(msgID, 10)
+	}
+	if caption != nil {
+		fields["caption"] = caption.Text
+		if len(caption.ParseMode) != 0 {
+			fields["parse_mode"] = caption.ParseMode
+		}
+		if entities := caption.SendEntities(); len(entities) != 0 {
+			raw, err := json.Marshal(entities)
+			if err != nil {
+				return err
+			}
+			fields["caption_entities"] = string(raw)
+		}
+	}
+
+	for k, v := range fields {
+		err := form.WriteField(k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("document", name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(part, data)
+	return err
+}
+
+func (b *Bot) AnswerCallbackQuery(queryID string, text string) error {
+	msg := struct {
+		QueryID string `json:"callback_query_id"`
+		Text    string `json:"text,omitempty"`
+	}{
+		QueryID: queryID,
+		Text:    text,
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.apiRequest("answerCallbackQuery", body)
+	return err
+}
+
+func (b *Bot) EditMessage(msgID int64, text *Text) error {
 	if b.channel == 0 {
 		return nil
 	}
 
 	msg := struct {
-		ChatId int64  `json:"chat_id"`
-		MsgID  int64  `json:"message_id"`
-		Text   string `json:"text"`
+		ChatId    int64            `json:"chat_id"`
+		MsgID     int64            `json:"message_id"`
+		Text      string           `json:"text"`
+		ParseMode string           `json:"parse_mode,omitempty"`
+		Entities  []*MessageEntity `json:"entities,omitempty"`
 	}{
-		ChatId: b.channel,
-		MsgID:  msgID,
-		Text:   text,
+		ChatId:    b.channel,
+		MsgID:     msgID,
+		Text:      text.Text,
+		ParseMode: text.ParseMode,
+		Entities:  text.SendEntities(),
 	}
 
 	body, err := json.Marshal(&msg)
 	if err != nil {
 		return err
 	}
-	log.Printf("Edit Message: %s", body)
+	log.Printf("telegram: editMessageText chat=%d msg=%d", msg.ChatId, msg.MsgID)
 
 	_, err = b.apiRequest("editMessageText", body)
 	if err != nil {
@@ -203,7 +564,7 @@ func (b *Bot) ForwardMessage(chatID int64, msgID int64) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	log.Printf("Forward Message: %s", body)
+	log.Printf("telegram: forwardMessage chat=%d from=%d msg=%d", msg.ChatId, msg.FromChatID, msg.MsgID)
 
 	resp, err := b.apiRequest("forwardMessage", body)
 	if err != nil {
@@ -219,6 +580,91 @@ func (b *Bot) ForwardMessage(chatID int64, msgID int64) (int64, error) {
 	return respMsg.ID, nil
 }
 
+// BroadcastMessage puts the message into the broadcast channel using
+// the configured mode and returns ids of the sent messages. In copy mode
+// the "Forwarded from" header is omitted and, if attribution is enabled,
+// a footer with author and chat is appended to the caption. Messages without
+// a caption or with no room left in it get the footer as a reply to the copy,
+// its id follows the id of the copy.
+func (b *Bot) BroadcastMessage(msg *Message) ([]int64, error) {
+	if b.mode != BroadcastModeCopy {
+		id, err := b.ForwardMessage(msg.Chat.ID, msg.ID)
+		return []int64{id}, err
+	}
+
+	if !b.attribution {
+		id, err := b.CopyMessage(msg.Chat.ID, msg.ID, nil)
+		return []int64{id}, err
+	}
+
+	footer := PlainText(msg.Attribution())
+	if msg.HasMedia() && len(msg.Caption) != 0 {
+		caption := EntitiesText(msg.Caption, msg.CaptionEntities).Append(AttributionSeparator, footer)
+		if UTF16Len(caption.Text) <= MaxCaptionLength {
+			id, err := b.CopyMessage(msg.Chat.ID, msg.ID, caption)
+			return []int64{id}, err
+		}
+	}
+
+	id, err := b.CopyMessage(msg.Chat.ID, msg.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	attrID, err := b.ReplyBroadcast(SplitText(footer, MaxMessageLength)[0], id)
+	if err != nil {
+		return []int64{id}, err
+	}
+
+	return []int64{id, attrID}, nil
+}
+
+// CopyMessage copies the message into the broadcast channel,
+// nil caption keeps the original one.
+func (b *Bot) CopyMessage(chatID int64, msgID int64, caption *Text) (int64, error) {
+	if b.channel == 0 {
+		return 0, nil
+	}
+
+	msg := struct {
+		ChatId          int64            `json:"chat_id"`
+		FromChatID      int64            `json:"from_chat_id"`
+		MsgID           int64            `json:"message_id"`
+		Caption         string           `json:"caption,omitempty"`
+		ParseMode       string           `json:"parse_mode,omitempty"`
+		CaptionEntities []*MessageEntity `json:"caption_entities,omitempty"`
+	}{
+		ChatId:     b.channel,
+		FromChatID: chatID,
+		MsgID:      msgID,
+	}
+	if caption != nil {
+		msg.Caption = caption.Text
+		msg.ParseMode = caption.ParseMode
+		msg.CaptionEntities = caption.SendEntities()
+	}
+
+	body, err := json.Marshal(&msg)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("telegram: copyMessage chat=%d from=%d msg=%d", msg.ChatId, msg.FromChatID, msg.MsgID)
+
+	resp, err := b.apiRequest("copyMessage", body)
+	if err != nil {
+		return 0, err
+	}
+
+	// copyMessage returns MessageId object which shares `message_id` field with Message
+	respMsg := Message{}
+	err = json.Unmarshal(resp, &respMsg)
+	if err != nil {
+		return 0, nil
+	}
+
+	return respMsg.ID, nil
+}
+
 func (b *Bot) DeleteMessage(msgID int64) error {
 	if b.channel == 0 {
 		return nil
@@ -236,14 +682,12 @@ func (b *Bot) DeleteMessage(msgID int64) error {
 	if err != nil {
 		return err
 	}
-	log.Printf("Forward Message: %s", body)
+	log.Printf("telegram: deleteMessage chat=%d msg=%d", msg.ChatId, msg.MsgID)
 
-	resp, err := b.apiRequest("deleteMessage", body)
+	_, err = b.apiRequest("deleteMessage", body)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Delete Response: %s", resp)
-
 	return nil
 }
@@ -0,0 +1,116 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testCall struct {
+	method  string
+	msgID   int64
+	replyTo int64
+}
+
+// testAPI answers Bot API calls and remembers them,
+// sent messages get ids from 100 on
+func testAPI() (*[]testCall, func()) {
+	var mu sync.Mutex
+	calls := make([]testCall, 0)
+	nextID := int64(100)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MsgID   int64 `json:"message_id"`
+			ReplyTo int64 `json:"reply_to_message_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		method := path.Base(r.URL.Path)
+		calls = append(calls, testCall{method, req.MsgID, req.ReplyTo})
+
+		result := "true"
+		if method == "sendMessage" {
+			result = fmt.Sprintf(`{"message_id": %d}`, nextID)
+			nextID++
+		}
+		_, _ = fmt.Fprintf(w, `{"ok": true, "result": %s}`, result)
+	}))
+
+	prev := apiURL
+	apiURL = srv.URL
+	return &calls, func() {
+		apiURL = prev
+		srv.Close()
+	}
+}
+
+func TestEditBroadcastChain(t *testing.T) {
+	long := strings.Repeat("a", MaxMessageLength) + strings.Repeat("b", MaxMessageLength) + "c"
+
+	tests := []struct {
+		name  string
+		ids   []int64
+		text  string
+		want  []int64
+		calls []testCall
+	}{
+		{
+			name: "same length",
+			ids:  []int64{1},
+			text: "edited",
+			want: []int64{1},
+			calls: []testCall{
+				{"editMessageText", 1, 0},
+			},
+		},
+		{
+			name: "shrinks",
+			ids:  []int64{1, 2, 3},
+			text: "short now",
+			want: []int64{1},
+			calls: []testCall{
+				{"editMessageText", 1, 0},
+				{"deleteMessage", 2, 0},
+				{"deleteMessage", 3, 0},
+			},
+		},
+		{
+			name: "grows",
+			ids:  []int64{1},
+			text: long,
+			want: []int64{1, 100, 101},
+			calls: []testCall{
+				{"editMessageText", 1, 0},
+				{"sendMessage", 0, 1},
+				{"sendMessage", 0, 100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		calls, done := testAPI()
+		bot := &Bot{token: "test", channel: -100}
+
+		got, err := bot.EditBroadcastChain(tt.ids, PlainText(tt.text))
+		done()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: chain is %v, want %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(*calls, tt.calls) {
+			t.Errorf("%s: calls are %v, want %v", tt.name, *calls, tt.calls)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Telegram Desktop exports supergroup and channel ids without -100 prefix
+const desktopChannelShift = 1000000000000
+
+var ErrDesktopExportEmpty = errors.New("telegram: export has no chats")
+
+// desktopEntityTypes maps entity types of Telegram Desktop export to Bot API ones,
+// plain text and unknown types produce no entity
+var desktopEntityTypes = map[string]string{
+	"bold":          "bold",
+	"italic":        "italic",
+	"underline":     "underline",
+	"strikethrough": "strikethrough",
+	"spoiler":       "spoiler",
+	"code":          "code",
+	"pre":           "pre",
+	"blockquote":    "blockquote",
+	"link":          EntityTypeURL,
+	"text_link":     EntityTypeTextLink,
+	"mention":       "mention",
+	"mention_name":  "text_mention",
+	"hashtag":       EntityTypeHashtag,
+	"cashtag":       "cashtag",
+	"bot_command":   EntityTypeBotCommand,
+	"email":         "email",
+	"phone":         "phone_number",
+	"bank_card":     "bank_card_number",
+}
+
+// DesktopChat is a chat of Telegram Desktop export converted into Bot API messages,
+// Skipped counts service messages which have no Bot API counterpart worth importing
+type DesktopChat struct {
+	Chat     *Chat
+	Messages []*Message
+	Skipped  int
+}
+
+type desktopExport struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Messages []*desktopMessage `json:"messages"`
+	Chats    *struct {
+		List []*desktopExport `json:"list"`
+	} `json:"chats,omitempty"`
+}
+
+type desktopMessage struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	Date         string          `json:"date"`
+	DateUnix     string          `json:"date_unixtime"`
+	Edited       string          `json:"edited"`
+	EditedUnix   string          `json:"edited_unixtime"`
+	From         string          `json:"from"`
+	FromID       string          `json:"from_id"`
+	ReplyTo      int64           `json:"reply_to_message_id"`
+	Text         json.RawMessage `json:"text"`
+	TextEntities []*desktopText  `json:"text_entities"`
+	Photo        string          `json:"photo"`
+	File         string          `json:"file"`
+	MediaType    string          `json:"media_type"`
+}
+
+type desktopText struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Href     string `json:"href"`
+	UserID   int64  `json:"user_id"`
+	Language string `json:"language"`
+}
+
+// ParseDesktopExport reads `result.json` of Telegram Desktop,
+// both single chat and whole account exports are supported
+func ParseDesktopExport(r io.Reader) ([]*DesktopChat, error) {
+	var exp desktopExport
+	err := json.NewDecoder(r).Decode(&exp)
+	if err != nil {
+		return nil, err
+	}
+
+	exports := []*desktopExport{&exp}
+	if exp.Chats != nil {
+		exports = exp.Chats.List
+	}
+
+	res := make([]*DesktopChat, 0, len(exports))
+	for _, e := range exports {
+		if e.ID == 0 {
+			continue
+		}
+		res = append(res, e.convert())
+	}
+
+	if len(res) == 0 {
+		return nil, ErrDesktopExportEmpty
+	}
+	return res, nil
+}
+
+func (e *desktopExport) convert() *DesktopChat {
+	chat := &Chat{Title: e.Name}
+	switch {
+	case strings.HasSuffix(e.Type, "supergroup"):
+		chat.ID, chat.Type = -desktopChannelShift-e.ID, "supergroup"
+	case strings.HasSuffix(e.Type, "channel"):
+		chat.ID, chat.Type = -desktopChannelShift-e.ID, ChatTypeChannel
+	case e.Type == "private_group":
+		chat.ID, chat.Type = -e.ID, "group"
+	default:
+		chat.ID, chat.Type = e.ID, ChatTypePrivate
+	}
+
+	res := &DesktopChat{Chat: chat, Messages: make([]*Message, 0, len(e.Messages))}
+	for _, dm := range e.Messages {
+		if dm.Type != "message" {
+			res.Skipped++
+			continue
+		}
+		res.Messages = append(res.Messages, dm.convert(chat))
+	}
+
+	return res
+}
+
+func (dm *desktopMessage) convert(chat *Chat) *Message {
+	msg := &Message{
+		ID:       dm.ID,
+		Chat:     chat,
+		Date:     desktopTime(dm.DateUnix, dm.Date),
+		EditDate: desktopTime(dm.EditedUnix, dm.Edited),
+	}
+
+	// Channel posts have no author but the channel itself
+	if id := desktopSenderID(dm.FromID); id != 0 && id != chat.ID {
+		msg.From = &User{ID: id, FirstName: dm.From}
+	}
+
+	if dm.ReplyTo != 0 {
+		msg.ReplyToMessage = &Message{ID: dm.ReplyTo, Chat: chat}
+	}
+
+	text, entities := desktopContent(dm.Text, dm.TextEntities)
+	if len(dm.Photo) != 0 || len(dm.File) != 0 || len(dm.MediaType) != 0 {
+		msg.Caption, msg.CaptionEntities = text, entities
+	} else {
+		msg.Text, msg.Entities = text, entities
+	}
+
+	return msg
+}
+
+// desktopContent joins text pieces computing UTF-16 offsets of entities,
+// `text_entities` of newer exports are preferred over mixed `text` array
+func desktopContent(raw json.RawMessage, pieces []*desktopText) (string, []*MessageEntity) {
+	if pieces == nil {
+		var plain string
+		if json.Unmarshal(raw, &plain) == nil {
+			return plain, make([]*MessageEntity, 0)
+		}
+
+		var mixed []json.RawMessage
+		_ = json.Unmarshal(raw, &mixed)
+		for _, m := range mixed {
+			p := &desktopText{Type: "plain"}
+			if json.Unmarshal(m, &p.Text) != nil {
+				_ = json.Unmarshal(m, p)
+			}
+			pieces = append(pieces, p)
+		}
+	}
+
+	var b strings.Builder
+	entities := make([]*MessageEntity, 0)
+	offset := 0
+	for _, p := range pieces {
+		length := UTF16Len(p.Text)
+		if t, ok := desktopEntityTypes[p.Type]; ok && length != 0 {
+			e := &MessageEntity{Type: t, Offset: offset, Length: length, URL: p.Href, Language: p.Language}
+			if p.UserID != 0 {
+				e.User = &User{ID: p.UserID}
+			}
+			entities = append(entities, e)
+		}
+		b.WriteString(p.Text)
+		offset += length
+	}
+
+	return b.String(), entities
+}
+
+// desktopSenderID converts `user123` and `channel123` ids into Bot API ones
+func desktopSenderID(id string) int64 {
+	switch {
+	case strings.HasPrefix(id, "user"):
+		n, _ := strconv.ParseInt(strings.TrimPrefix(id, "user"), 10, 64)
+		return n
+	case strings.HasPrefix(id, "channel"):
+		n, err := strconv.ParseInt(strings.TrimPrefix(id, "channel"), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return -desktopChannelShift - n
+	}
+	return 0
+}
+
+// desktopTime prefers unix time of newer exports, older ones only have local time
+func desktopTime(unix string, local string) int64 {
+	if n, err := strconv.ParseInt(unix, 10, 64); err == nil {
+		return n
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", local, time.Local); err == nil {
+		return t.Unix()
+	}
+	return 0
+}
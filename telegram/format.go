@@ -0,0 +1,194 @@
+package telegram
+
+import (
+	"html"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+)
+
+// markdownV2Special lists characters which must be escaped outside of
+// entities according to https://core.telegram.org/bots/api#markdownv2-style
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// Text is a message body together with the way Telegram should format it.
+// ParseMode and Entities are mutually exclusive: when ParseMode is set
+// Telegram ignores entities, so only one of them is sent.
+type Text struct {
+	Text      string
+	ParseMode string
+	Entities  []*MessageEntity
+}
+
+func PlainText(text string) *Text {
+	return &Text{Text: text}
+}
+
+func MarkdownText(text string) *Text {
+	return &Text{Text: text, ParseMode: ParseModeMarkdownV2}
+}
+
+func HTMLText(text string) *Text {
+	return &Text{Text: text, ParseMode: ParseModeHTML}
+}
+
+func EntitiesText(text string, entities []*MessageEntity) *Text {
+	return &Text{Text: text, Entities: entities}
+}
+
+// SendEntities returns entities to be sent along with the text, if any.
+func (t *Text) SendEntities() []*MessageEntity {
+	if len(t.ParseMode) != 0 || len(t.Entities) == 0 {
+		return nil
+	}
+	return t.Entities
+}
+
+// Append adds text to the end keeping entities of both parts in place.
+func (t *Text) Append(sep string, other *Text) *Text {
+	shift := UTF16Len(t.Text) + UTF16Len(sep)
+	entities := make([]*MessageEntity, 0, len(t.Entities)+len(other.Entities))
+	entities = append(entities, t.Entities...)
+	entities = append(entities, ShiftEntities(other.Entities, shift)...)
+
+	return &Text{
+		Text:      t.Text + sep + other.Text,
+		ParseMode: t.ParseMode,
+		Entities:  entities,
+	}
+}
+
+func EscapeMarkdownV2(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(markdownV2Special, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func EscapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// UTF16Len returns length of the string in UTF-16 code units,
+// which is what Telegram uses for entity offsets and lengths.
+func UTF16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// UTF16Slice cuts the string using UTF-16 code unit offsets.
+func UTF16Slice(s string, offset int, length int) string {
+	units := utf16.Encode([]rune(s))
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(units) {
+		return ""
+	}
+	end := offset + length
+	if end > len(units) {
+		end = len(units)
+	}
+	return string(utf16.Decode(units[offset:end]))
+}
+
+func ShiftEntities(entities []*MessageEntity, shift int) []*MessageEntity {
+	res := make([]*MessageEntity, 0, len(entities))
+	for _, e := range entities {
+		moved := *e
+		moved.Offset += shift
+		res = append(res, &moved)
+	}
+	return res
+}
+
+// SplitText breaks the text into parts no longer than limit UTF-16 code units.
+// It prefers to cut after a line break or a space which is not covered by an
+// entity, entities crossing a cut are clipped into both parts. Separators stay
+// at the end of the previous part, since Telegram trims leading whitespace and
+// that would shift entity offsets of the next part.
+func SplitText(t *Text, limit int) []*Text {
+	units := utf16.Encode([]rune(t.Text))
+	if len(units) <= limit || limit <= 0 {
+		return []*Text{t}
+	}
+
+	parts := make([]*Text, 0, len(units)/limit+1)
+	for start := 0; start < len(units); {
+		end := start + limit
+		if end >= len(units) {
+			end = len(units)
+		} else {
+			end = splitPoint(units, t.Entities, start, end)
+		}
+
+		parts = append(parts, &Text{
+			Text:      string(utf16.Decode(units[start:end])),
+			ParseMode: t.ParseMode,
+			Entities:  clipEntities(t.Entities, start, end),
+		})
+		start = end
+	}
+
+	return parts
+}
+
+func splitPoint(units []uint16, entities []*MessageEntity, start int, end int) int {
+	for _, sep := range []uint16{'\n', ' '} {
+		for p := end; p > start; p-- {
+			if units[p-1] == sep && !insideEntity(entities, p) {
+				return p
+			}
+		}
+	}
+
+	for p := end; p > start; p-- {
+		if !insideEntity(entities, p) && !utf16.IsSurrogate(rune(units[p-1])) {
+			return p
+		}
+	}
+
+	// Nothing better, just do not break a surrogate pair
+	if utf16.IsSurrogate(rune(units[end-1])) && end-1 > start {
+		return end - 1
+	}
+	return end
+}
+
+func insideEntity(entities []*MessageEntity, p int) bool {
+	for _, e := range entities {
+		if e.Offset < p && p < e.Offset+e.Length {
+			return true
+		}
+	}
+	return false
+}
+
+func clipEntities(entities []*MessageEntity, start int, end int) []*MessageEntity {
+	res := make([]*MessageEntity, 0)
+	for _, e := range entities {
+		from, to := e.Offset, e.Offset+e.Length
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		if from >= to {
+			continue
+		}
+
+		clipped := *e
+		clipped.Offset = from - start
+		clipped.Length = to - from
+		res = append(res, &clipped)
+	}
+	return res
+}
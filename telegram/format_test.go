@@ -0,0 +1,127 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testEntity struct {
+	offset int
+	length int
+}
+
+func entitySpans(entities []*MessageEntity) []testEntity {
+	res := make([]testEntity, 0, len(entities))
+	for _, e := range entities {
+		res = append(res, testEntity{e.Offset, e.Length})
+	}
+	return res
+}
+
+func bold(offset int, length int) *MessageEntity {
+	return &MessageEntity{Type: "bold", Offset: offset, Length: length}
+}
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []*MessageEntity
+		limit    int
+		parts    []string
+		spans    [][]testEntity
+	}{
+		{
+			name:  "fits",
+			text:  "short",
+			limit: 10,
+			parts: []string{"short"},
+			spans: [][]testEntity{{}},
+		},
+		{
+			name:  "line break goes first",
+			text:  "aa bb\ncc dd",
+			limit: 9,
+			parts: []string{"aa bb\n", "cc dd"},
+			spans: [][]testEntity{{}, {}},
+		},
+		{
+			name:  "no whitespace",
+			text:  "abcdefghij",
+			limit: 4,
+			parts: []string{"abcd", "efgh", "ij"},
+			spans: [][]testEntity{{}, {}, {}},
+		},
+		{
+			name:  "surrogate pair at the limit",
+			text:  "ab😀cd",
+			limit: 3,
+			parts: []string{"ab", "😀c", "d"},
+			spans: [][]testEntity{{}, {}, {}},
+		},
+		{
+			name:  "surrogate pairs only",
+			text:  "😀😀😀",
+			limit: 3,
+			parts: []string{"😀", "😀", "😀"},
+			spans: [][]testEntity{{}, {}, {}},
+		},
+		{
+			name:     "entity moves to the next part",
+			text:     "aaaa bbbb",
+			entities: []*MessageEntity{bold(5, 4)},
+			limit:    6,
+			parts:    []string{"aaaa ", "bbbb"},
+			spans:    [][]testEntity{{}, {{0, 4}}},
+		},
+		{
+			name:     "space inside entity is not a split point",
+			text:     "hello world foo",
+			entities: []*MessageEntity{bold(6, 9)},
+			limit:    12,
+			parts:    []string{"hello ", "world foo"},
+			spans:    [][]testEntity{{}, {{0, 9}}},
+		},
+		{
+			name:     "entity crossing the split is clipped",
+			text:     "aaa bbb ccc",
+			entities: []*MessageEntity{bold(0, 11)},
+			limit:    8,
+			parts:    []string{"aaa bbb ", "ccc"},
+			spans:    [][]testEntity{{{0, 8}}, {{0, 3}}},
+		},
+		{
+			name:     "entity offsets are in UTF-16 units",
+			text:     "😀 ab cd",
+			entities: []*MessageEntity{bold(3, 5)},
+			limit:    6,
+			parts:    []string{"😀 ", "ab cd"},
+			spans:    [][]testEntity{{}, {{0, 5}}},
+		},
+	}
+
+	for _, tt := range tests {
+		parts := SplitText(EntitiesText(tt.text, tt.entities), tt.limit)
+
+		texts := make([]string, 0, len(parts))
+		spans := make([][]testEntity, 0, len(parts))
+		for _, p := range parts {
+			if UTF16Len(p.Text) > tt.limit {
+				t.Errorf("%s: part %q is longer than %d", tt.name, p.Text, tt.limit)
+			}
+			texts = append(texts, p.Text)
+			spans = append(spans, entitySpans(p.Entities))
+		}
+
+		if !reflect.DeepEqual(texts, tt.parts) {
+			t.Errorf("%s: parts are %q, want %q", tt.name, texts, tt.parts)
+		}
+		if !reflect.DeepEqual(spans, tt.spans) {
+			t.Errorf("%s: entities are %v, want %v", tt.name, spans, tt.spans)
+		}
+		if strings.Join(texts, "") != tt.text {
+			t.Errorf("%s: parts do not add up to the text", tt.name)
+		}
+	}
+}
@@ -9,10 +9,14 @@ import (
 const (
 	EntityTypeBotCommand = "bot_command"
 	EntityTypeHashtag    = "hashtag"
+	EntityTypeURL        = "url"
+	EntityTypeTextLink   = "text_link"
 
 	ChatTypeChannel = "channel"
+	ChatTypePrivate = "private"
 
-	JoinSeparator = " ➜ "
+	JoinSeparator        = " ➜ "
+	AttributionSeparator = "\n\n— "
 )
 
 type Chat struct {
@@ -81,10 +85,7 @@ type PollAnswer json.RawMessage
 type PassportData json.RawMessage
 type SuccessfulPayment json.RawMessage
 type Invoice json.RawMessage
-type InlineKeyboardMarkup json.RawMessage
-type InlineQuery json.RawMessage
 type ChosenInlineResult json.RawMessage
-type CallbackQuery json.RawMessage
 type ShippingQuery json.RawMessage
 type PreCheckoutQuery json.RawMessage
 
@@ -110,7 +111,7 @@ type Message struct {
 	Document              *Document             `json:"document,omitempty"`
 	Animation             *Animation            `json:"animation,omitempty"`
 	Game                  *Game                 `json:"game,omitempty"`
-	Photo                 []*PhotoSize          `json:"photo_size,omitempty"`
+	Photo                 []*PhotoSize          `json:"photo,omitempty"`
 	Sticker               Sticker               `json:"sticker,omitempty"`
 	Video                 *Video                `json:"video,omitempty"`
 	Voice                 *Voice                `json:"voice,omitempty"`
@@ -138,6 +139,82 @@ type Message struct {
 	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
 }
 
+type ReactionType struct {
+	Type          string `json:"type"`
+	Emoji         string `json:"emoji,omitempty"`
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+}
+
+type ReactionCount struct {
+	Type       *ReactionType `json:"type"`
+	TotalCount int           `json:"total_count"`
+}
+
+type MessageReactionUpdated struct {
+	Chat        *Chat           `json:"chat"`
+	MessageID   int64           `json:"message_id"`
+	User        *User           `json:"user,omitempty"`
+	ActorChat   *Chat           `json:"actor_chat,omitempty"`
+	Date        int64           `json:"date"`
+	OldReaction []*ReactionType `json:"old_reaction"`
+	NewReaction []*ReactionType `json:"new_reaction"`
+}
+
+type MessageReactionCountUpdated struct {
+	Chat      *Chat            `json:"chat"`
+	MessageID int64            `json:"message_id"`
+	Date      int64            `json:"date"`
+	Reactions []*ReactionCount `json:"reactions"`
+}
+
+type InlineQuery struct {
+	ID       string `json:"id"`
+	From     *User  `json:"from"`
+	Query    string `json:"query"`
+	Offset   string `json:"offset"`
+	ChatType string `json:"chat_type,omitempty"`
+}
+
+type InputTextMessageContent struct {
+	MessageText string           `json:"message_text"`
+	ParseMode   string           `json:"parse_mode,omitempty"`
+	Entities    []*MessageEntity `json:"entities,omitempty"`
+}
+
+type InlineQueryResultArticle struct {
+	Type                string                   `json:"type"`
+	ID                  string                   `json:"id"`
+	Title               string                   `json:"title"`
+	InputMessageContent *InputTextMessageContent `json:"input_message_content"`
+	URL                 string                   `json:"url,omitempty"`
+	Description         string                   `json:"description,omitempty"`
+}
+
+type ChatMember struct {
+	User     *User  `json:"user"`
+	Status   string `json:"status"`
+	IsMember bool   `json:"is_member,omitempty"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]*InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type CallbackQuery struct {
+	ID              string   `json:"id"`
+	From            *User    `json:"from"`
+	Message         *Message `json:"message,omitempty"`
+	InlineMessageID string   `json:"inline_message_id,omitempty"`
+	ChatInstance    string   `json:"chat_instance"`
+	Data            string   `json:"data,omitempty"`
+}
+
 type Update struct {
 	ID                 int64               `json:"update_id"`
 	Message            *Message            `json:"message,omitempty"`
@@ -151,6 +228,74 @@ type Update struct {
 	PreCheckoutQuery   *PreCheckoutQuery   `json:"pre_checkout_query,omitempty"`
 	Poll               *Poll               `json:"poll,omitempty"`
 	PollAnswer         *PollAnswer         `json:"poll_answer,omitempty"`
+
+	MessageReaction      *MessageReactionUpdated      `json:"message_reaction,omitempty"`
+	MessageReactionCount *MessageReactionCountUpdated `json:"message_reaction_count,omitempty"`
+}
+
+// AllowedUpdates lists update types the bot subscribes to with setWebhook,
+// reactions are not delivered unless explicitly requested.
+var AllowedUpdates = []string{
+	"message",
+	"edited_message",
+	"channel_post",
+	"edited_channel_post",
+	"message_reaction",
+	"message_reaction_count",
+	"callback_query",
+	"inline_query",
+}
+
+const (
+	ChatMemberCreator       = "creator"
+	ChatMemberAdministrator = "administrator"
+	ChatMemberMember        = "member"
+	ChatMemberRestricted    = "restricted"
+)
+
+// Present reports whether the user is currently in the chat.
+func (m *ChatMember) Present() bool {
+	switch m.Status {
+	case ChatMemberCreator, ChatMemberAdministrator, ChatMemberMember:
+		return true
+	case ChatMemberRestricted:
+		return m.IsMember
+	}
+	return false
+}
+
+// MessageLink builds t.me link to the message, private chats
+// are addressed by internal id and open only for their members.
+func MessageLink(chatID int64, username string, msgID int64) string {
+	if len(username) != 0 {
+		return fmt.Sprintf("https://t.me/%s/%d", username, msgID)
+	}
+
+	// Supergroups and channels ids look like -100XXXXXXXXXX
+	internal := -chatID - 1000000000000
+	if internal < 0 {
+		internal = -chatID
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", internal, msgID)
+}
+
+// ReactorID returns id of the user or the chat on behalf of which reaction was changed.
+func (r *MessageReactionUpdated) ReactorID() int64 {
+	if r.User != nil {
+		return r.User.ID
+	}
+	if r.ActorChat != nil {
+		return r.ActorChat.ID
+	}
+	return 0
+}
+
+// Key returns emoji or custom emoji id identifying the reaction.
+func (r *ReactionType) Key() string {
+	if len(r.CustomEmojiID) != 0 {
+		return r.CustomEmojiID
+	}
+	return r.Emoji
 }
 
 func (msg *Message) Text2Save() string {
@@ -174,22 +319,46 @@ func (msg *Message) Text2Save() string {
 	return strings.Join(texts, JoinSeparator)
 }
 
+// Content returns text to save along with its entities,
+// so formatting survives in broadcasts.
+func (msg *Message) Content() *Text {
+	return EntitiesText(msg.Text2Save(), msg.Entities)
+}
+
 func (msg *Message) Tags() []string {
 	tags := make([]string, 0)
 	for _, e := range msg.Entities {
 		if e.Type == EntityTypeHashtag {
-			tags = append(tags, msg.Text[e.Offset:e.Offset+e.Length])
+			tags = append(tags, UTF16Slice(msg.Text, e.Offset, e.Length))
 		}
 	}
 	return tags
 }
 
+// URLs returns links mentioned in the text or caption, both plain and hidden under text.
+func (msg *Message) URLs() []string {
+	urls := make([]string, 0)
+	collect := func(text string, entities []*MessageEntity) {
+		for _, e := range entities {
+			switch e.Type {
+			case EntityTypeURL:
+				urls = append(urls, UTF16Slice(text, e.Offset, e.Length))
+			case EntityTypeTextLink:
+				urls = append(urls, e.URL)
+			}
+		}
+	}
+	collect(msg.Text, msg.Entities)
+	collect(msg.Caption, msg.CaptionEntities)
+	return urls
+}
+
 func (msg *Message) Command() (string, string) {
 	for _, e := range msg.Entities {
 		if e.Type == EntityTypeBotCommand {
 			// in channels bot command looks like `/command@NameBot`
 			// so we split string by @ and then take first segment from second letter to the end
-			parts := strings.Split(msg.Text[e.Offset:e.Offset+e.Length], "@")
+			parts := strings.Split(UTF16Slice(msg.Text, e.Offset, e.Length), "@")
 			var receiver string
 			// It could be direct command not in chat
 			if len(parts) == 1 {
@@ -204,6 +373,36 @@ func (msg *Message) Command() (string, string) {
 	return "", ""
 }
 
+// CommandArgs returns whitespace separated words following the bot command.
+func (msg *Message) CommandArgs() []string {
+	for _, e := range msg.Entities {
+		if e.Type == EntityTypeBotCommand {
+			return strings.Fields(UTF16Slice(msg.Text, e.Offset+e.Length, UTF16Len(msg.Text)))
+		}
+	}
+
+	return nil
+}
+
+// CommandText returns text following the bot command along with its entities.
+func (msg *Message) CommandText() *Text {
+	for _, e := range msg.Entities {
+		if e.Type != EntityTypeBotCommand {
+			continue
+		}
+
+		units := UTF16Len(msg.Text)
+		start := e.Offset + e.Length
+		for start < units && strings.TrimSpace(UTF16Slice(msg.Text, start, 1)) == "" {
+			start++
+		}
+
+		return EntitiesText(UTF16Slice(msg.Text, start, units-start), clipEntities(msg.Entities, start, units))
+	}
+
+	return PlainText("")
+}
+
 func (msg *Message) Author() *User {
 	if msg.From == nil {
 		return &User{
@@ -217,11 +416,34 @@ func (msg *Message) Author() *User {
 	return msg.From
 }
 
-func (user *User) ComposeWhoAmIMessage() string {
-	return fmt.Sprintf(
-		"*Name*: %s %s\n*Username*: %s\n*ID*:%d",
-		user.FirstName,
-		user.LastName,
-		user.UserName,
-		user.ID)
+// HasMedia reports whether the message carries an attachment that
+// Telegram treats as captioned content rather than plain text.
+func (msg *Message) HasMedia() bool {
+	return msg.Audio != nil || msg.Document != nil || msg.Animation != nil ||
+		len(msg.Photo) != 0 || msg.Video != nil || msg.Voice != nil
+}
+
+// Attribution composes the footer used for copied broadcasts,
+// e.g. `John Doe (@john), Some Chat`.
+func (msg *Message) Attribution() string {
+	author := msg.Author()
+	name := strings.TrimSpace(author.FirstName + " " + author.LastName)
+	if len(author.UserName) != 0 {
+		name = fmt.Sprintf("%s (@%s)", name, author.UserName)
+	}
+
+	if msg.Chat == nil || len(msg.Chat.Title) == 0 || msg.From == nil {
+		return name
+	}
+
+	return fmt.Sprintf("%s, %s", name, msg.Chat.Title)
+}
+
+func (user *User) ComposeWhoAmIMessage() *Text {
+	return MarkdownText(fmt.Sprintf(
+		"*Name*: %s %s\n*Username*: %s\n*ID*: %s",
+		EscapeMarkdownV2(user.FirstName),
+		EscapeMarkdownV2(user.LastName),
+		EscapeMarkdownV2(user.UserName),
+		EscapeMarkdownV2(fmt.Sprintf("%d", user.ID))))
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/kalambet/telecollector/http"
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const commandUserData = "userdata"
+
+// cliAdminID marks audit log entries made from the command line
+const cliAdminID = 0
+
+// runUserData implements `telecollector userdata export [-o file] <author_id>`
+// and `telecollector userdata erase [-anonymize] <author_id>`
+func runUserData(args []string) error {
+	if len(args) == 0 {
+		return errors.New("export or erase is required")
+	}
+
+	fs := flag.NewFlagSet(commandUserData+" "+args[0], flag.ExitOnError)
+	out := fs.String("o", "", "export file, stdout by default")
+	anonymize := fs.Bool("anonymize", false, "keep entries without the author instead of deleting them")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("author id is required")
+	}
+	authorID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return errors.New("author id should be a number")
+	}
+
+	switch args[0] {
+	case "export":
+		var w io.Writer = os.Stdout
+		if len(*out) != 0 {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		d, err := http.NewOfflineServer(&svc, nil).ExportUserData(cliAdminID, authorID, w)
+		if err != nil {
+			return err
+		}
+		log.Printf("userdata: exported %s", d.String())
+	case "erase":
+		// Broadcasts can only be deleted on behalf of the bot
+		bot, err := telecollector.NewBot(os.Getenv("TG_TOKEN"))
+		if err != nil {
+			return err
+		}
+
+		report, err := http.NewOfflineServer(&svc, bot).EraseUserData(cliAdminID, authorID, *anonymize)
+		if err != nil {
+			return err
+		}
+		log.Printf("userdata: %s", report.String())
+	default:
+		return errors.New("export or erase is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/kalambet/telecollector/telecollector"
+)
+
+const commandVault = "vault"
+
+// runVault implements `telecollector vault -dir <path> [flags]`,
+// syncing the collection into a Markdown vault incrementally
+func runVault(args []string) error {
+	fs := flag.NewFlagSet(commandVault, flag.ExitOnError)
+	dir := fs.String("dir", "", "vault directory")
+	tags := fs.String("tag", "", "comma separated tags every entry must have")
+	chats := fs.String("chat", "", "comma separated chat ids")
+	full := fs.Bool("full", false, "rewrite every note instead of the changed ones")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(*dir) == 0 {
+		return errors.New("vault directory is required")
+	}
+
+	filters := make([]string, 0)
+	for _, t := range splitList(*tags) {
+		filters = append(filters, "#"+strings.TrimPrefix(t, "#"))
+	}
+	for _, c := range splitList(*chats) {
+		filters = append(filters, "chat:"+c)
+	}
+
+	q, err := telecollector.ParseSearchQuery(filters)
+	if err != nil {
+		return err
+	}
+
+	report, err := telecollector.SyncVault(svc.Messages, *dir, q, *full)
+	if err != nil {
+		return err
+	}
+
+	mode := "changes since " + report.SyncSince.Format("2006-01-02 15:04:05")
+	if report.Full {
+		mode = "full"
+	}
+	log.Printf("vault: %s sync, %d notes written, %d removed, %d tag pages",
+		mode, report.Written, report.Removed, report.TagPages)
+	return nil
+}